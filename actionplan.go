@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+type PlannedAction struct {
+	Description string
+	fn          func() error
+}
+
+// ActionPlan is an ordered list of actions that are printed to the user for
+// confirmation and then run one after another.
+type ActionPlan struct {
+	Actions []*PlannedAction
+
+	logger func(int, string)
+}
+
+func (ap *ActionPlan) SetLogger(f func(int, string)) {
+	ap.logger = f
+}
+
+func (ap *ActionPlan) Add(d string, fn func() error) {
+	ap.Actions = append(ap.Actions, &PlannedAction{Description: d, fn: fn})
+}
+
+func (ap *ActionPlan) PrintActions(f *os.File, hdr string) {
+	if len(ap.Actions) == 0 {
+		return
+	}
+	fmt.Fprintf(f, "%s:\n", hdr)
+	for i, a := range ap.Actions {
+		fmt.Fprintf(f, "  %d. %s\n", i+1, a.Description)
+	}
+}
+
+func (ap *ActionPlan) Apply() error {
+	failed := 0
+	for _, a := range ap.Actions {
+		ap.logger(LOGINF, a.Description+"...")
+		err := a.fn()
+		if err != nil {
+			ap.logger(LOGERR, fmt.Sprintf("%s: %s", a.Description, err.Error()))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d of %d actions have failed", failed, len(ap.Actions)))
+	}
+	return nil
+}
+
+func NewActionPlan() *ActionPlan {
+	ap := &ActionPlan{}
+	ap.Actions = []*PlannedAction{}
+	return ap
+}
@@ -3,45 +3,301 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
+const BASE_DEFAULT_ARCH = "amd64"
+
+// Architectures bases can be downloaded for with their machine_arch used in
+// mirror paths
+var baseArchs = map[string]string{
+	"amd64": "amd64",
+	"arm64": "aarch64",
+	"i386":  "i386",
+}
+
+const BASE_SET_BASE = "base"
+
+// Distribution sets of a release that can be downloaded
+var baseSets = []string{"base", "kernel", "lib32", "ports", "src", "tests"}
+
 type Base struct {
 	Release     string `json:"release"`
+	Arch        string `json:"arch"`
 	SourceURL   string `json:"source_url"`
 	Created     string `json:"created"`
 	LastUpdated string `json:"last_updated"`
 	Iteration   int    `json:"iteration"`
 
+	// Sets lists downloaded distribution sets, nil means base only
+	Sets []string `json:"sets"`
+
+	// RootSets lists sets extracted into the root shared by thin jails
+	RootSets []string `json:"root_sets"`
+
+	// Dataset is set when base directory is a ZFS dataset. Extracted root is
+	// then its child dataset which snapshot jails are cloned from.
+	Dataset      string `json:"dataset"`
+	RootSnapshot string `json:"root_snapshot"`
+
+	// SHA256 holds verified checksums of downloaded files
+	SHA256   map[string]string `json:"sha256"`
+	Verified bool              `json:"verified"`
+
+	// ManifestGenerated is set when MANIFEST has been generated from
+	// imported files. Such base is never verified.
+	ManifestGenerated bool `json:"manifest_generated"`
+
 	Dirpath string          `json:"dirpath"`
 	History []*HistoryEntry `json:"history"`
 
-	logger func(int, string)
+	mirrors    []string
+	downloader *Downloader
+	logger     func(int, string)
 }
 
 func (bs *Base) SetLogger(f func(int, string)) {
 	bs.logger = f
 }
 
+func (bs *Base) SetMirrors(l []string) {
+	bs.mirrors = l
+}
+
+func (bs *Base) SetDownloader(dl *Downloader) {
+	bs.downloader = dl
+}
+
+func IsValidBaseArch(a string) bool {
+	_, ok := baseArchs[a]
+	return ok
+}
+
+// BaseSetFromFilename returns distribution set a file is named after, MANIFEST
+// or empty string when the name does not match any set
+func BaseSetFromFilename(p string) string {
+	n := path.Base(p)
+	if n == "MANIFEST" {
+		return n
+	}
+	for _, ext := range []string{".txz", ".tar.xz", ".tgz", ".tar.gz", ".tar"} {
+		if strings.HasSuffix(n, ext) {
+			n = strings.TrimSuffix(n, ext)
+			if IsValidBaseSet(n) {
+				return n
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+func IsValidBaseSet(s string) bool {
+	for _, v := range baseSets {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBaseSets returns distribution sets from comma-separated list keeping
+// their order. Set 'base' is always included and put first when missing.
+func ParseBaseSets(s string) ([]string, error) {
+	l := []string{BASE_SET_BASE}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || v == BASE_SET_BASE {
+			continue
+		}
+		if !IsValidBaseSet(v) {
+			return nil, errors.New(fmt.Sprintf("Distribution set %s is not supported. Valid sets are: %s", v, strings.Join(baseSets, ", ")))
+		}
+		dup := false
+		for _, v2 := range l {
+			if v2 == v {
+				dup = true
+			}
+		}
+		if !dup {
+			l = append(l, v)
+		}
+	}
+	return l, nil
+}
+
+// GetBaseURL returns URL of file f of a release on mirror m. Snapshots of
+// STABLE and CURRENT branches live in a different directory than releases,
+// betas and release candidates.
+func GetBaseURL(m string, rls string, arch string, f string) string {
+	d := "releases"
+	if strings.HasSuffix(rls, "-STABLE") || strings.HasSuffix(rls, "-CURRENT") {
+		d = "snapshots"
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s/%s", m, d, arch, baseArchs[arch], rls, f)
+}
+
+func (bs *Base) getManifestPath() string {
+	return bs.Dirpath + "/MANIFEST"
+}
+
+func (bs *Base) GetSets() []string {
+	if len(bs.Sets) == 0 {
+		return []string{BASE_SET_BASE}
+	}
+	return bs.Sets
+}
+
+// GetMissingSets returns sets from l that have not been downloaded
+func (bs *Base) GetMissingSets(l []string) []string {
+	m := []string{}
+	for _, s := range l {
+		found := false
+		for _, s2 := range bs.GetSets() {
+			if s == s2 {
+				found = true
+			}
+		}
+		if !found {
+			m = append(m, s)
+		}
+	}
+	return m
+}
+
+func (bs *Base) GetSetTarballPath(s string) string {
+	return bs.Dirpath + "/" + s + ".txz"
+}
+
+func (bs *Base) getSetFiles() []string {
+	fs := []string{}
+	for _, s := range bs.GetSets() {
+		fs = append(fs, s+".txz")
+	}
+	return fs
+}
+
+// fetchFiles downloads files of the release trying mirrors in order and
+// returns URL of the last downloaded one. Files are downloaded to temporary
+// files and moved into place only when they match the MANIFEST.
+func (bs *Base) fetchFiles(fs []string) (string, error) {
+	if bs.Arch == "" {
+		bs.Arch = BASE_DEFAULT_ARCH
+	}
+	if len(bs.mirrors) == 0 {
+		return "", errors.New("No mirrors to download base from have been configured")
+	}
+
+	url := ""
+	var err error
+	for _, m := range bs.mirrors {
+		mfPath := bs.getManifestPath()
+		sets := []string{}
+		for _, f := range fs {
+			p := bs.Dirpath + "/" + f
+			if f == "MANIFEST" {
+				// MANIFEST of a snapshot changes so it is never resumed
+				_ = os.Remove(GetDownloadPartPath(p))
+				mfPath = GetDownloadPartPath(p)
+			} else {
+				sets = append(sets, f)
+			}
+			url = GetBaseURL(m, bs.Release, bs.Arch, f)
+			err = bs.downloader.Fetch(url, p)
+			if err != nil {
+				bs.logger(LOGINF, fmt.Sprintf("Downloading %s has failed: %s", url, err.Error()))
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+
+		_, err = bs.checkFiles(mfPath, sets, DOWNLOADER_PART_SUFFIX)
+		if err != nil {
+			bs.logger(LOGINF, fmt.Sprintf("Files downloaded from %s are invalid: %s", m, err.Error()))
+			for _, f := range sets {
+				_ = os.Remove(GetDownloadPartPath(bs.Dirpath + "/" + f))
+			}
+			continue
+		}
+
+		for _, f := range fs {
+			p := bs.Dirpath + "/" + f
+			err = os.Rename(GetDownloadPartPath(p), p)
+			if err != nil {
+				return url, errors.New(fmt.Sprintf("Error has occurred when moving %s into place: %s", p, err.Error()))
+			}
+			if f == "MANIFEST" {
+				bs.ManifestGenerated = false
+			}
+		}
+		break
+	}
+	return url, err
+}
+
+// GetArch returns architecture of the base. Bases downloaded before it was
+// stored are of the default one.
+func (bs *Base) GetArch() string {
+	if bs.Arch == "" {
+		return BASE_DEFAULT_ARCH
+	}
+	return bs.Arch
+}
+
+// checkFiles compares SHA256 of files fs with suffix sfx against MANIFEST at
+// mfPath and returns the checksums
+func (bs *Base) checkFiles(mfPath string, fs []string, sfx string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(mfPath)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Cannot read MANIFEST of base %s: %s", bs.Release, err.Error()))
+	}
+	mf := ParseBaseManifest(b)
+
+	hs := map[string]string{}
+	for _, f := range fs {
+		if mf[f] == "" {
+			return nil, errors.New(fmt.Sprintf("File %s is not listed in MANIFEST of base %s", f, bs.Release))
+		}
+		bs.logger(LOGDBG, fmt.Sprintf("Calculating SHA256 of %s...", bs.Dirpath+"/"+f+sfx))
+		h, err := FileSHA256(bs.Dirpath + "/" + f + sfx)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Cannot calculate SHA256 of %s: %s", f, err.Error()))
+		}
+		if h != mf[f] {
+			return nil, errors.New(fmt.Sprintf("SHA256 of %s of base %s does not match MANIFEST", f, bs.Release))
+		}
+		hs[f] = h
+	}
+	return hs, nil
+}
+
 func (bs *Base) SetDefaultValues() {
 	bs.Iteration = 1
 }
 
-func (bs *Base) AddHistoryEntry(s string) {
-	he := NewHistoryEntry(GetCurrentDateTime(), s)
+func (bs *Base) AddHistoryEntry(op string, p map[string]string, err error) {
+	he := NewHistoryEntry(op, "base", bs.Release, p, err)
 	if bs.History == nil {
 		bs.History = []*HistoryEntry{}
 	}
 	bs.History = append(bs.History, he)
 }
 
-func (bs *Base) Download(ow bool) error {
+// prepareDir creates directory of the base or re-creates it when ow is true
+func (bs *Base) prepareDir(ow bool) error {
 	_, _, err := StatWithLog(bs.Dirpath, bs.logger)
 
 	if err != nil {
 		if os.IsNotExist(err) {
 			bs.logger(LOGDBG, "Jail directory does not exist and it has to be created")
-			err2 := CreateDirWithLog(bs.Dirpath, bs.logger)
+			err2 := bs.createDir()
 			if err2 != nil {
 				return err2
 			}
@@ -50,35 +306,206 @@ func (bs *Base) Download(ow bool) error {
 		}
 	} else {
 		if !ow {
-			return errors.New(fmt.Sprintf("Base %s already exists. Use 'overwrite' flag to remove it and download again", bs.Release))
+			_, _, err2 := StatWithLog(bs.GetBaseTarballPath(), bs.logger)
+			if err2 == nil || !os.IsNotExist(err2) {
+				return errors.New(fmt.Sprintf("Base %s already exists. Use 'overwrite' flag to remove it and download again", bs.Release))
+			}
+			bs.logger(LOGDBG, fmt.Sprintf("Directory of base %s exists without base set so previous download will be resumed", bs.Release))
 		} else {
 			bs.logger(LOGDBG, fmt.Sprintf("Base %s already exists but 'overwrite' flag was provided so it will be re-created", bs.Release))
 			bs.Iteration++
 
-			err2 := RemoveAllWithLog(bs.Dirpath, bs.logger)
+			err2 := bs.Remove()
 			if err2 != nil {
 				return errors.New("Error has occurred when removing existing base")
 			}
 
-			err2 = CreateDirWithLog(bs.Dirpath, bs.logger)
+			err2 = bs.createDir()
 			if err2 != nil {
 				return errors.New("Error has occurred when creating new directory for base")
 			}
 		}
 	}
 
-	if err == nil && ow {
-		bs.AddHistoryEntry("Download again (overwrite)")
+	return nil
+}
+
+func (bs *Base) getZFS() *ZFS {
+	z := NewZFS()
+	z.SetLogger(bs.logger)
+	return z
+}
+
+func (bs *Base) createDir() error {
+	if bs.Dataset != "" && !bs.getZFS().Exists(bs.Dataset) {
+		return bs.getZFS().Create(bs.Dataset)
+	}
+	return CreateDirWithLog(bs.Dirpath, bs.logger)
+}
+
+func (bs *Base) Download(ow bool) error {
+	err := bs.prepareDir(ow)
+	if err != nil {
+		return err
 	}
 
-	url := fmt.Sprintf("http://ftp.freebsd.org/pub/FreeBSD/releases/amd64/%s/base.txz", bs.Release)
-	err = CmdFetchWithLog(url, bs.Dirpath+"/base.txz", bs.logger)
+	url, err := bs.fetchFiles(append([]string{"MANIFEST"}, bs.getSetFiles()...))
+	p := map[string]string{"url": url, "arch": bs.Arch, "sets": strings.Join(bs.GetSets(), ","), "overwrite": strconv.FormatBool(ow)}
 	if err != nil {
-		return errors.New("Error has occurred when downloading base. Please try again or fix base manually")
+		bs.AddHistoryEntry("download", p, err)
+		return errors.New("Error has occurred when downloading base from all the mirrors. Please try again or fix base manually")
 	}
 	bs.LastUpdated = GetCurrentDateTime()
 	bs.SourceURL = url
+	bs.SHA256 = nil
+	bs.RootSets = nil
+	bs.RootSnapshot = ""
+	bs.Verified = false
+	bs.AddHistoryEntry("download", p, nil)
+
+	return bs.Verify()
+}
+
+// ImportFiles copies local files or downloads URLs from srcs into the base.
+// Sets are named after the files so lib32.txz becomes 'lib32' and a file that
+// is not named after any set is taken as 'base'. When MANIFEST is not among
+// the sources, one is generated from checksums of the imported files. Files
+// are always stored as <set>.txz as tar detects compression on extraction.
+func (bs *Base) ImportFiles(srcs []string, ow bool) error {
+	fs := map[string]string{}
+	sets := []string{}
+	for _, src := range srcs {
+		if HasURLScheme(src) && !IsURL(src) {
+			return errors.New(fmt.Sprintf("Cannot import %s. Only http and https URLs are supported, download the file and import it from a local path", src))
+		}
+		s := BaseSetFromFilename(src)
+		if s == "" {
+			if fs[BASE_SET_BASE] != "" {
+				return errors.New(fmt.Sprintf("Cannot tell distribution set of %s. Name the file after the set, eg. lib32.txz", src))
+			}
+			s = BASE_SET_BASE
+		}
+		if fs[s] != "" {
+			return errors.New(fmt.Sprintf("Distribution set %s has been provided more than once", s))
+		}
+		fs[s] = src
+		if s != "MANIFEST" {
+			sets = append(sets, s)
+		}
+	}
+	if fs[BASE_SET_BASE] == "" {
+		return errors.New("Base set has not been provided")
+	}
+
+	err := bs.prepareDir(ow)
+	if err != nil {
+		return err
+	}
+
+	bs.Sets = []string{BASE_SET_BASE}
+	for _, s := range sets {
+		if s != BASE_SET_BASE {
+			bs.Sets = append(bs.Sets, s)
+		}
+	}
+
+	p := map[string]string{"sources": strings.Join(srcs, ","), "sets": strings.Join(bs.Sets, ","), "overwrite": strconv.FormatBool(ow)}
+	for s, src := range fs {
+		dst := bs.GetSetTarballPath(s)
+		if s == "MANIFEST" {
+			dst = bs.getManifestPath()
+		}
+		if IsURL(src) {
+			err = bs.downloader.Fetch(src, dst)
+			if err == nil {
+				err = os.Rename(GetDownloadPartPath(dst), dst)
+			}
+		} else {
+			err = CopyFileWithLog(src, dst, bs.logger)
+		}
+		if err != nil {
+			bs.AddHistoryEntry("import", p, err)
+			return errors.New(fmt.Sprintf("Error has occurred when importing %s: %s", src, err.Error()))
+		}
+	}
+
+	if fs["MANIFEST"] == "" {
+		mf := ""
+		for _, f := range bs.getSetFiles() {
+			h, err := FileSHA256(bs.Dirpath + "/" + f)
+			if err != nil {
+				bs.AddHistoryEntry("import", p, err)
+				return errors.New(fmt.Sprintf("Cannot calculate SHA256 of %s: %s", f, err.Error()))
+			}
+			mf += fmt.Sprintf("%s\t%s\n", f, h)
+		}
+		err = WriteFileAtomicWithLog(bs.getManifestPath(), []byte(mf), 0644, bs.logger)
+		if err != nil {
+			bs.AddHistoryEntry("import", p, err)
+			return err
+		}
+		p["manifest"] = "generated"
+	}
+	bs.ManifestGenerated = fs["MANIFEST"] == ""
+
+	bs.LastUpdated = GetCurrentDateTime()
+	bs.SourceURL = strings.Join(srcs, ",")
+	bs.SHA256 = nil
+	bs.RootSets = nil
+	bs.RootSnapshot = ""
+	bs.Verified = false
+	bs.AddHistoryEntry("import", p, nil)
 
+	return bs.Verify()
+}
+
+// AddSets downloads sets l into an existing base
+func (bs *Base) AddSets(l []string) error {
+	fs := []string{"MANIFEST"}
+	for _, s := range l {
+		fs = append(fs, s+".txz")
+	}
+
+	url, err := bs.fetchFiles(fs)
+	p := map[string]string{"url": url, "sets": strings.Join(l, ",")}
+	if err != nil {
+		bs.AddHistoryEntry("add_sets", p, err)
+		return errors.New("Error has occurred when downloading sets from all the mirrors. Please try again or fix base manually")
+	}
+	bs.Sets = append(bs.GetSets(), l...)
+	bs.LastUpdated = GetCurrentDateTime()
+	bs.Verified = false
+	bs.AddHistoryEntry("add_sets", p, nil)
+
+	return bs.Verify()
+}
+
+// DownloadManifest gets MANIFEST of the release for bases downloaded before
+// checksums were verified
+func (bs *Base) DownloadManifest() error {
+	_, err := bs.fetchFiles([]string{"MANIFEST"})
+	if err != nil {
+		return errors.New("Error has occurred when downloading MANIFEST from all the mirrors")
+	}
+	return nil
+}
+
+// Verify checks SHA256 of downloaded files against the MANIFEST of the release
+func (bs *Base) Verify() error {
+	hs, err := bs.checkFiles(bs.getManifestPath(), bs.getSetFiles(), "")
+	bs.AddHistoryEntry("verify", nil, err)
+	if err != nil {
+		bs.Verified = false
+		return err
+	}
+	bs.SHA256 = hs
+	if bs.ManifestGenerated {
+		bs.Verified = false
+		bs.logger(LOGDBG, fmt.Sprintf("Base %s matches MANIFEST generated on import which cannot be trusted", bs.Release))
+		return nil
+	}
+	bs.Verified = true
+	bs.logger(LOGDBG, fmt.Sprintf("Base %s has been verified", bs.Release))
 	return nil
 }
 
@@ -92,6 +519,7 @@ func (bs *Base) Import() error {
 		}
 	}
 	bs.logger(LOGDBG, "Base source exists and it can be imported")
+	bs.AddHistoryEntry("import", nil, nil)
 	return nil
 }
 
@@ -106,6 +534,13 @@ func (bs *Base) Remove() error {
 		}
 	}
 
+	if bs.Dataset != "" && bs.getZFS().Exists(bs.Dataset) {
+		err = bs.getZFS().Destroy(bs.Dataset)
+		if err != nil {
+			return err
+		}
+	}
+	_ = CmdRun(bs.logger, "chflags", "-R", "noschg", bs.Dirpath)
 	return RemoveAllWithLog(bs.Dirpath, bs.logger)
 }
 
@@ -129,13 +564,165 @@ func (bs *Base) CreateJailSource(p string) error {
 	}
 	bs.logger(LOGDBG, fmt.Sprintf("Jail source directory %s has been successfully created", p))
 
-	bs.AddHistoryEntry(fmt.Sprintf("Create jail source directory %s", p))
+	bs.AddHistoryEntry("create_jail_source", map[string]string{"path": p}, nil)
 
 	return nil
 }
 
+func (bs *Base) GetRootPath() string {
+	return bs.Dirpath + "/root"
+}
+
+// GetMissingRootSets returns sets from l that have not been extracted into the
+// root yet
+func (bs *Base) GetMissingRootSets(l []string) []string {
+	m := []string{}
+	for _, s := range l {
+		found := false
+		for _, s2 := range bs.RootSets {
+			if s == s2 {
+				found = true
+			}
+		}
+		if !found {
+			m = append(m, s)
+		}
+	}
+	return m
+}
+
+// ExtractRoot extracts sets into the root shared by thin jails. Sets that
+// have already been extracted are skipped.
+func (bs *Base) ExtractRoot(sets []string) error {
+	m := bs.GetMissingRootSets(sets)
+	if len(m) == 0 {
+		return nil
+	}
+
+	p := map[string]string{"path": bs.GetRootPath(), "sets": strings.Join(m, ",")}
+	if len(bs.RootSets) == 0 {
+		// Root left by an extraction that has not been recorded
+		if bs.Dataset != "" && bs.getZFS().Exists(bs.GetRootDataset()) {
+			err := bs.getZFS().Destroy(bs.GetRootDataset())
+			if err != nil {
+				return err
+			}
+		}
+		_, _, err := StatWithLog(bs.GetRootPath(), bs.logger)
+		if err == nil {
+			_ = CmdRun(bs.logger, "chflags", "-R", "noschg", bs.GetRootPath())
+			err = RemoveAllWithLog(bs.GetRootPath(), bs.logger)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var err error
+	if bs.Dataset != "" && !bs.getZFS().Exists(bs.GetRootDataset()) {
+		err = bs.getZFS().Create(bs.GetRootDataset())
+	} else {
+		err = CreateDirWithLog(bs.GetRootPath(), bs.logger)
+	}
+	if err != nil {
+		bs.AddHistoryEntry("extract_root", p, err)
+		return err
+	}
+	for _, s := range m {
+		err = CmdTarExtractWithLog(bs.GetSetTarballPath(s), bs.GetRootPath(), bs.logger)
+		if err != nil {
+			bs.AddHistoryEntry("extract_root", p, err)
+			return errors.New(fmt.Sprintf("Error has occurred when extracting set %s of base %s", s, bs.Release))
+		}
+		bs.RootSets = append(bs.RootSets, s)
+	}
+
+	if bs.Dataset != "" {
+		snap := bs.GetRootDataset() + "@sets_" + strings.Join(bs.RootSets, "_")
+		err = bs.getZFS().Snapshot(snap)
+		if err != nil {
+			bs.AddHistoryEntry("extract_root", p, err)
+			return err
+		}
+		bs.RootSnapshot = snap
+		p["snapshot"] = snap
+	}
+
+	bs.AddHistoryEntry("extract_root", p, nil)
+	return nil
+}
+
+// GetRootSnapshot returns snapshot of the root when it has exactly sets
+// extracted, otherwise jail cannot be cloned from it
+func (bs *Base) GetRootSnapshot(sets []string) string {
+	if bs.RootSnapshot == "" || len(bs.RootSets) != len(sets) {
+		return ""
+	}
+	for _, s := range sets {
+		found := false
+		for _, s2 := range bs.RootSets {
+			if s == s2 {
+				found = true
+			}
+		}
+		if !found {
+			return ""
+		}
+	}
+	return bs.RootSnapshot
+}
+
+func (bs *Base) GetRootDataset() string {
+	if bs.Dataset == "" {
+		return ""
+	}
+	return bs.Dataset + "/root"
+}
+
 func (bs *Base) GetBaseTarballPath() string {
-	return bs.Dirpath + "/base.txz"
+	return bs.GetSetTarballPath(BASE_SET_BASE)
+}
+
+// GetSHA256 returns verified checksum of the base set
+func (bs *Base) GetSHA256() string {
+	if bs.SHA256 == nil {
+		return ""
+	}
+	return bs.SHA256[BASE_SET_BASE+".txz"]
+}
+
+var baseReleaseRe = regexp.MustCompile(`^([0-9]+)\.([0-9]+)-(RELEASE|BETA([0-9]+)|RC([0-9]+)|STABLE|CURRENT)$`)
+
+// Order of release kinds of the same version, from the oldest
+var baseReleaseKinds = map[string]int{"BETA": 1, "RC": 2, "RELEASE": 3, "STABLE": 4, "CURRENT": 5}
+
+// ParseBaseRelease returns major version of release rls and numbers that make
+// releases sortable. Names of imported bases may not be releases and then
+// false is returned.
+func ParseBaseRelease(rls string) (string, []int, bool) {
+	m := baseReleaseRe.FindStringSubmatch(rls)
+	if m == nil {
+		return "", nil, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	kind := strings.TrimRight(m[3], "0123456789")
+	num, _ := strconv.Atoi(m[4] + m[5])
+	return m[1], []int{major, minor, baseReleaseKinds[kind], num}, true
+}
+
+// IsBaseReleaseNewer returns true when release a is newer than release b
+func IsBaseReleaseNewer(a string, b string) bool {
+	_, va, oka := ParseBaseRelease(a)
+	_, vb, okb := ParseBaseRelease(b)
+	if !oka || !okb {
+		return a > b
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			return va[i] > vb[i]
+		}
+	}
+	return false
 }
 
 func NewBase(rls string, dir string) *Base {
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBaseExtractRootSnapshot(t *testing.T) {
+	d, err := ioutil.TempDir("", "jailguard-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tc := newTestCmds()
+	defer tc.install()()
+	z := newTestZFS(map[string]string{"tank/jg": d})
+	z.install(tc)
+
+	bs := NewBase("14.1-RELEASE", d+"/bases/14.1-RELEASE")
+	bs.SetLogger(func(int, string) {})
+	bs.Dataset = "tank/jg/bases/14.1-RELEASE"
+	err = bs.createDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc.Run = []string{}
+	err = bs.ExtractRoot([]string{"base"})
+	if err != nil {
+		t.Fatalf("ExtractRoot returned error: %s", err.Error())
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"zfs create -p tank/jg/bases/14.1-RELEASE/root",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/base.txz -C " + d + "/bases/14.1-RELEASE/root",
+		"zfs snapshot tank/jg/bases/14.1-RELEASE/root@sets_base",
+	})
+	if bs.GetRootSnapshot([]string{"base"}) != "tank/jg/bases/14.1-RELEASE/root@sets_base" {
+		t.Errorf("Root snapshot is '%s'", bs.RootSnapshot)
+	}
+
+	// Only missing sets are extracted and a new snapshot is taken
+	tc.Run = []string{}
+	err = bs.ExtractRoot([]string{"base", "lib32"})
+	if err != nil {
+		t.Fatalf("ExtractRoot returned error: %s", err.Error())
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"tar -xvf " + d + "/bases/14.1-RELEASE/lib32.txz -C " + d + "/bases/14.1-RELEASE/root",
+		"zfs snapshot tank/jg/bases/14.1-RELEASE/root@sets_base_lib32",
+	})
+	if bs.GetRootSnapshot([]string{"base"}) != "" {
+		t.Errorf("Root with lib32 can be cloned for base only")
+	}
+	if bs.GetRootSnapshot([]string{"lib32", "base"}) != "tank/jg/bases/14.1-RELEASE/root@sets_base_lib32" {
+		t.Errorf("Root snapshot is '%s'", bs.RootSnapshot)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+)
+
+// ParseBaseManifest returns SHA256 of each distribution set listed in the
+// MANIFEST file of a release. Each line of the file consists of tab separated
+// file name, checksum, number of files, name, description and default state.
+func ParseBaseManifest(b []byte) map[string]string {
+	m := map[string]string{}
+	for _, l := range strings.Split(string(b), "\n") {
+		fs := strings.Split(strings.TrimSpace(l), "\t")
+		if len(fs) < 2 || fs[0] == "" {
+			continue
+		}
+		m[fs[0]] = strings.ToLower(fs[1])
+	}
+	return m
+}
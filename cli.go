@@ -21,14 +21,22 @@ func NewJailguardCLI(j *Jailguard) *cli.CLI {
 	j.AddStateCmds(c)
 	j.AddBaseCmds(c)
 	j.AddJailCmds(c)
+	j.AddJailSnapshotCmds(c)
+	j.AddTemplateCmds(c)
 	j.AddNetifCmds(c)
 	j.AddPFAnchorCmds(c)
 	j.AddJailPortFwdCmds(c)
 	j.AddJailNATPassCmds(c)
 	j.AddConfigCmds(c)
+	j.AddJournalCmds(c)
+	j.AddGuardCmds(c)
 
-	c.AddFlagToCmds("quiet", "q", "", "Do not output anything", cli.TypeBool)
-	c.AddFlagToCmds("debug", "d", "", "Print more information", cli.TypeBool)
+	// AddFlagToCmds in go-cli names the flag after each command so flags are
+	// attached one by one
+	for _, n := range c.GetSortedCmds() {
+		c.GetCmd(n).AddFlag("quiet", "q", "", "Do not output anything", cli.TypeBool)
+		c.GetCmd(n).AddFlag("debug", "d", "", "Print more information", cli.TypeBool)
+	}
 
 	_ = c.AddCmd("version", "Prints version", getCLIVersionHandler(j))
 
@@ -2,10 +2,15 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/nicholasgasior/go-cli"
 	"regexp"
+	"strconv"
 )
 
+// Sets and MANIFEST that can be passed to base_import
+const BASE_IMPORT_MAX_SOURCES = 7
+
 func (j *Jailguard) getCLIBaseDownloadHandler() func(*cli.CLI) int {
 	fn := func(c *cli.CLI) int {
 		if c.Flag("debug") == "true" {
@@ -20,7 +25,13 @@ func (j *Jailguard) getCLIBaseDownloadHandler() func(*cli.CLI) int {
 			ow = true
 		}
 
-		err := j.DownloadBase(c.Arg("release"), ow)
+		sets, err := ParseBaseSets(c.Flag("sets"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+
+		err = j.DownloadBase(c.Arg("release"), c.Flag("arch"), sets, ow)
 		if err != nil {
 			j.Log(LOGERR, err.Error())
 			return 2
@@ -39,7 +50,92 @@ func (j *Jailguard) getCLIBaseRemoveHandler() func(*cli.CLI) int {
 			j.Quiet = true
 		}
 
-		err := j.RemoveBase(c.Arg("release"))
+		cascade := false
+		if c.Flag("cascade") == "true" {
+			cascade = true
+		}
+		err := j.RemoveBase(c.Arg("release"), cascade)
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIBaseImportHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		ow := false
+		if c.Flag("overwrite") == "true" {
+			ow = true
+		}
+
+		srcs := []string{}
+		for i := 1; i <= BASE_IMPORT_MAX_SOURCES; i++ {
+			if c.Arg(getBaseImportSourceArg(i)) != "" {
+				srcs = append(srcs, c.Arg(getBaseImportSourceArg(i)))
+			}
+		}
+
+		err := j.ImportBase(c.Arg("name"), srcs, c.Flag("arch"), ow)
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func getBaseImportSourceArg(i int) string {
+	if i == 1 {
+		return "source"
+	}
+	return fmt.Sprintf("source_%d", i)
+}
+
+func (j *Jailguard) getCLIBaseVerifyHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.VerifyBase(c.Arg("release"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIBasePruneHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		keep := 0
+		if c.Flag("keep") != "" {
+			keep, _ = strconv.Atoi(c.Flag("keep"))
+		}
+
+		err := j.PruneBases(keep, c.Flag("dry-run") == "true")
 		if err != nil {
 			j.Log(LOGERR, err.Error())
 			return 2
@@ -66,19 +162,51 @@ func (j *Jailguard) AddBaseCmds(c *cli.CLI) {
 	// TODO: Change 'release' flag to TypeAlphanumeric once AllowHyphen gets implemented in go-cli
 	base_download.AddArg("release", "RELEASE", "", cli.TypeString|cli.Required)
 	base_download.AddFlag("overwrite", "w", "", "Overwrite if exists", cli.TypeBool)
+	base_download.AddFlag("arch", "a", "amd64|arm64|i386", "Architecture, defaults to the one of the system", cli.TypeAlphanumeric)
+	base_download.AddFlag("sets", "s", "base,lib32,src", "Comma-separated distribution sets to download, defaults to base", cli.TypeString)
 
 	_ = c.AddCmd("base_list", "List FreeBSD bases", j.getCLIBaseListHandler())
 
 	base_remove := c.AddCmd("base_remove", "Removes FreeBSD base", j.getCLIBaseRemoveHandler())
 	base_remove.AddArg("release", "RELEASE", "", cli.TypeAlphanumeric|cli.AllowHyphen|cli.AllowUnderscore|cli.AllowDots|cli.Required)
+	base_remove.AddFlag("cascade", "c", "", "Remove jails using the base as well", cli.TypeBool)
+
+	base_prune := c.AddCmd("base_prune", "Removes FreeBSD bases that no jail uses", j.getCLIBasePruneHandler())
+	base_prune.AddFlag("keep", "k", "N", "Keep N newest bases of each major version", cli.TypeInt)
+	base_prune.AddFlag("dry-run", "r", "", "Only print bases that would be removed", cli.TypeBool)
+
+	base_import := c.AddCmd("base_import", "Imports FreeBSD base from local files or http(s) URLs", j.getCLIBaseImportHandler())
+	base_import.AddArg("name", "NAME", "", cli.TypeAlphanumeric|cli.AllowHyphen|cli.AllowUnderscore|cli.AllowDots|cli.Required)
+	base_import.AddArg("source", "PATH_OR_URL", "", cli.TypeString|cli.Required)
+	for i := 2; i <= BASE_IMPORT_MAX_SOURCES; i++ {
+		base_import.AddArg(getBaseImportSourceArg(i), "PATH_OR_URL", "", cli.TypeString)
+	}
+	base_import.AddFlag("overwrite", "w", "", "Overwrite if exists", cli.TypeBool)
+	base_import.AddFlag("arch", "a", "amd64|arm64|i386", "Architecture, defaults to the one of the system", cli.TypeAlphanumeric)
+	base_import.AddPostValidation(func(c *cli.CLI) error {
+		if c.Flag("arch") != "" && !IsValidBaseArch(c.Flag("arch")) {
+			return errors.New("Flag --arch has invalid value")
+		}
+		return nil
+	})
+
+	base_verify := c.AddCmd("base_verify", "Verifies FreeBSD base against MANIFEST", j.getCLIBaseVerifyHandler())
+	base_verify.AddArg("release", "RELEASE", "", cli.TypeAlphanumeric|cli.AllowHyphen|cli.AllowUnderscore|cli.AllowDots|cli.Required)
 
 	// Add release validation
 	rls_download := func(c *cli.CLI) error {
-		re := regexp.MustCompile(`^[12][0-9]\.[0-9]{1,2}\-RELEASE$`)
+		re := regexp.MustCompile(`^[1-9][0-9]?\.[0-9]{1,2}\-(RELEASE|BETA[0-9]{1,2}|RC[0-9]{1,2}|STABLE|CURRENT)$`)
 		m := re.Match([]byte(c.Arg("release")))
 		if !m {
 			return errors.New("Argument RELEASE has invalid value")
 		}
+		if c.Flag("arch") != "" && !IsValidBaseArch(c.Flag("arch")) {
+			return errors.New("Flag --arch has invalid value")
+		}
+		_, err := ParseBaseSets(c.Flag("sets"))
+		if err != nil {
+			return err
+		}
 		return nil
 	}
 	base_download.AddPostValidation(rls_download)
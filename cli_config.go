@@ -54,9 +54,23 @@ func (j *Jailguard) getCLIConfigListHandler() func(*cli.CLI) int {
 	return fn
 }
 
+func (j *Jailguard) getCLIConfigDescribeHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		err := j.DescribeConfig()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
 func (j *Jailguard) AddConfigCmds(c *cli.CLI) {
 	_ = c.AddCmd("config_list", "List configuration", j.getCLIConfigListHandler())
 
+	_ = c.AddCmd("config_describe", "Describe all configuration keys", j.getCLIConfigDescribeHandler())
+
 	cfg_get := c.AddCmd("config_get", "Get specific configuration value", j.getCLIConfigGetHandler())
 	cfg_get.AddArg("key", "KEY", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.Required)
 
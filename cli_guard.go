@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"github.com/nicholasgasior/go-cli"
+)
+
+var guardResetClasses = []string{GUARDRESET_NATPASS, GUARDRESET_PORTFWD, GUARDRESET_JAIL, GUARDRESET_NETIF, GUARDRESET_BASE}
+
+func (j *Jailguard) getCLIGuardResetHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		cls := []string{}
+		for _, cl := range guardResetClasses {
+			if c.Flag("all") == "true" || c.Flag(cl) == "true" {
+				cls = append(cls, cl)
+			}
+		}
+
+		err := j.ResetGuard(cls, c.Flag("dry-run") == "true", c.Flag("yes") == "true")
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIGuardRelocateHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.RelocateGuard(c.Arg("path_data"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) AddGuardCmds(c *cli.CLI) {
+	reset := c.AddCmd("guard_reset", "Remove everything jailguard manages of selected kinds", j.getCLIGuardResetHandler())
+	reset.AddFlag("all", "a", "", "Remove everything", cli.TypeBool)
+	reset.AddFlag("natpass", "n", "", "Remove NAT passes", cli.TypeBool)
+	reset.AddFlag("portfwd", "p", "", "Remove port forwardings", cli.TypeBool)
+	reset.AddFlag("jail", "j", "", "Stop and remove jails", cli.TypeBool)
+	reset.AddFlag("netif", "i", "", "Destroy network interfaces", cli.TypeBool)
+	reset.AddFlag("base", "b", "", "Remove bases", cli.TypeBool)
+	reset.AddFlag("dry-run", "r", "", "Only list what would be removed", cli.TypeBool)
+	reset.AddFlag("yes", "y", "", "Do not ask for confirmation", cli.TypeBool)
+	reset.AddPostValidation(func(c *cli.CLI) error {
+		if c.Flag("all") == "true" {
+			return nil
+		}
+		for _, cl := range guardResetClasses {
+			if c.Flag(cl) == "true" {
+				return nil
+			}
+		}
+		return errors.New("At least one of --all, --natpass, --portfwd, --jail, --netif, --base flags is required")
+	})
+
+	relocate := c.AddCmd("guard_relocate", "Move data directory to a new path", j.getCLIGuardRelocateHandler())
+	relocate.AddArg("path_data", "NEW_PATH_DATA", "", cli.TypeString|cli.Required)
+}
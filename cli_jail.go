@@ -30,7 +30,15 @@ func (j *Jailguard) getCLIJailCreateHandler() func(*cli.CLI) int {
 		if c.Flag("start") == "true" {
 			start = true
 		}
-		err := j.CreateJail(c.Arg("file"), c.Flag("base"), start)
+		insecure := false
+		if c.Flag("insecure") == "true" {
+			insecure = true
+		}
+		thin := false
+		if c.Flag("thin") == "true" {
+			thin = true
+		}
+		err := j.CreateJail(c.Arg("file"), c.Flag("base"), c.Flag("sets"), start, insecure, thin, c.Flag("template"))
 		if err != nil {
 			j.Log(LOGERR, err.Error())
 			return 2
@@ -106,6 +114,10 @@ func (j *Jailguard) AddJailCmds(c *cli.CLI) {
 	create.AddArg("file", "JAIL_JSON_FILE", "", cli.TypePathFile|cli.MustExist|cli.Required)
 	create.AddFlag("base", "b", "", "Base to use", cli.TypeAlphanumeric|cli.AllowDots|cli.AllowUnderscore|cli.AllowHyphen)
 	create.AddFlag("start", "s", "", "Start jail after creating", cli.TypeBool)
+	create.AddFlag("insecure", "i", "", "Allow unverified base or template", cli.TypeBool)
+	create.AddFlag("thin", "t", "", "Share read-only base with other thin jails instead of extracting a copy", cli.TypeBool)
+	create.AddFlag("template", "p", "NAME", "Template to create jail from instead of base, defaults to 'jailguard.template' from the file", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen)
+	create.AddFlag("sets", "e", "base,lib32", "Comma-separated distribution sets to extract, defaults to 'jailguard.sets' from the file or base", cli.TypeString)
 
 	remove := c.AddCmd("jail_remove", "Remove jail source", j.getCLIJailRemoveHandler())
 	remove.AddArg("jail", "JAIL", "", cli.TypeString|cli.Required)
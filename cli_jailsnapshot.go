@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"github.com/nicholasgasior/go-cli"
+)
+
+func (j *Jailguard) getCLIJailSnapshotHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.SnapshotJail(c.Arg("jail"), c.Arg("label"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIJailSnapshotListHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.ListJailSnapshots(c.Arg("jail"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIJailRollbackHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.RollbackJail(c.Arg("jail"), c.Arg("snapshot"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIJailSnapshotRemoveHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.RemoveJailSnapshot(c.Arg("jail"), c.Arg("snapshot"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) AddJailSnapshotCmds(c *cli.CLI) {
+	snapshot := c.AddCmd("jail_snapshot", "Take snapshot of jail directory", j.getCLIJailSnapshotHandler())
+	snapshot.AddArg("jail", "JAIL", "", cli.TypeString|cli.Required)
+	snapshot.AddArg("label", "LABEL", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen)
+
+	list := c.AddCmd("jail_snapshot_list", "List snapshots of jails", j.getCLIJailSnapshotListHandler())
+	list.AddArg("jail", "JAIL", "", cli.TypeString)
+
+	rollback := c.AddCmd("jail_rollback", "Restore jail directory from snapshot, restarting jail if it is running", j.getCLIJailRollbackHandler())
+	rollback.AddArg("jail", "JAIL", "", cli.TypeString|cli.Required)
+	rollback.AddArg("snapshot", "SNAPSHOT", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.AllowDots|cli.Required)
+
+	remove := c.AddCmd("jail_snapshot_remove", "Remove snapshot of jail", j.getCLIJailSnapshotRemoveHandler())
+	remove.AddArg("jail", "JAIL", "", cli.TypeString|cli.Required)
+	remove.AddArg("snapshot", "SNAPSHOT", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.AllowDots|cli.Required)
+
+	fn := func(c *cli.CLI) error {
+		if c.Arg("jail") != "" && !IsValidJailName(c.Arg("jail")) {
+			return errors.New("Argument JAIL is not a valid jail name")
+		}
+		return nil
+	}
+	snapshot.AddPostValidation(fn)
+	list.AddPostValidation(fn)
+	rollback.AddPostValidation(fn)
+	remove.AddPostValidation(fn)
+}
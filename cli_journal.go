@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/nicholasgasior/go-cli"
+)
+
+func (j *Jailguard) getCLIJournalShowHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.ShowJournal()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIJournalRollbackHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.RollbackJournal()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIJournalResumeHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.ResumeJournal()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) AddJournalCmds(c *cli.CLI) {
+	_ = c.AddCmd("journal_show", "Show operation that has not finished", j.getCLIJournalShowHandler())
+	_ = c.AddCmd("journal_rollback", "Undo steps of operation that has not finished", j.getCLIJournalRollbackHandler())
+	_ = c.AddCmd("journal_resume", "Continue operation that has not finished", j.getCLIJournalResumeHandler())
+}
@@ -48,7 +48,11 @@ func (j *Jailguard) getCLINetifDestroyHandler() func(*cli.CLI) int {
 			j.Quiet = true
 		}
 
-		err := j.DestroyNetif(c.Arg("name"))
+		cascade := false
+		if c.Flag("cascade") == "true" {
+			cascade = true
+		}
+		err := j.DestroyNetif(c.Arg("name"), cascade)
 		if err != nil {
 			j.Log(LOGERR, err.Error())
 			return 2
@@ -86,7 +90,11 @@ func (j *Jailguard) getCLINetifAliasDeleteHandler() func(*cli.CLI) int {
 			j.Quiet = true
 		}
 
-		err := j.DeleteNetifAlias(c.Arg("name"), c.Arg("ip_addr"))
+		cascade := false
+		if c.Flag("cascade") == "true" {
+			cascade = true
+		}
+		err := j.DeleteNetifAlias(c.Arg("name"), c.Arg("ip_addr"), cascade)
 		if err != nil {
 			j.Log(LOGERR, err.Error())
 			return 2
@@ -157,6 +165,7 @@ func (j *Jailguard) AddNetifCmds(c *cli.CLI) {
 
 	destroy := c.AddCmd("netif_destroy", "Destroy network interface", j.getCLINetifDestroyHandler())
 	destroy.AddArg("name", "NAME", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
+	destroy.AddFlag("cascade", "c", "", "Remove jails using the interface as well", cli.TypeBool)
 
 	_ = c.AddCmd("netif_list", "List network interfaces", j.getCLINetifListHandler())
 
@@ -167,6 +176,7 @@ func (j *Jailguard) AddNetifCmds(c *cli.CLI) {
 	alias_delete := c.AddCmd("netif_alias_delete", "Delete alias IP address from a network interface", j.getCLINetifAliasDeleteHandler())
 	alias_delete.AddArg("name", "NAME", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
 	alias_delete.AddArg("ip_addr", "IPv4_ADDR", "", cli.TypeString|cli.Required)
+	alias_delete.AddFlag("cascade", "c", "", "Remove jails using the alias as well", cli.TypeBool)
 
 	alias_list := c.AddCmd("netif_alias_list", "List network interface alias IP addresses", j.getCLINetifAliasListHandler())
 	alias_list.AddArg("name", "NAME", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
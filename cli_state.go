@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"github.com/nicholasgasior/go-cli"
+	"strconv"
 )
 
 func (j *Jailguard) getCLIStateListHandler() func(*cli.CLI) int {
@@ -53,6 +55,136 @@ func (j *Jailguard) getCLIStateImportHandler() func(*cli.CLI) int {
 	return fn
 }
 
+func (j *Jailguard) getCLIStateCheckHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+
+		drift, err := j.PrintStateCheck()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		if drift {
+			return 3
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIStateFixHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+
+		yes := false
+		if c.Flag("yes") == "true" {
+			yes = true
+		}
+
+		err := j.FixState(c.Flag("towards"), yes)
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIStateSnapshotHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+
+		err := j.TakeStateSnapshot(c.Arg("label"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIStateSnapshotListHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		err := j.ListStateSnapshots()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIStateRollbackHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+
+		show := false
+		if c.Flag("show_changes") == "true" {
+			show = true
+		}
+
+		err := j.RollbackState(c.Arg("snapshot"), show)
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLIStateHistoryHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+
+		hq := &HistoryQuery{
+			ItemType:  c.Flag("type"),
+			ItemName:  c.Flag("name"),
+			Operation: c.Flag("operation"),
+		}
+		if c.Flag("since") != "" {
+			hq.Since, _ = ParseHistoryTime(c.Flag("since"))
+		}
+		if c.Flag("until") != "" {
+			hq.Until, _ = ParseHistoryUntil(c.Flag("until"))
+		}
+		if c.Flag("limit") != "" {
+			hq.Limit, _ = strconv.Atoi(c.Flag("limit"))
+		}
+
+		asJSON := false
+		if c.Flag("json") == "true" {
+			asJSON = true
+		}
+
+		archived := false
+		if c.Flag("archived") == "true" {
+			archived = true
+		}
+
+		err := j.QueryStateHistory(hq, archived, asJSON)
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
 func (j *Jailguard) AddStateCmds(c *cli.CLI) {
 	_ = c.AddCmd("state_list", "Lists saved state items", j.getCLIStateListHandler())
 
@@ -63,4 +195,46 @@ func (j *Jailguard) AddStateCmds(c *cli.CLI) {
 	st_import := c.AddCmd("state_import", "Import item to state", j.getCLIStateImportHandler())
 	st_import.AddArg("item_type", "TYPE", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
 	st_import.AddArg("item_name", "NAME", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
+
+	_ = c.AddCmd("state_check", "Compare state with the system and exit with 3 when they differ", j.getCLIStateCheckHandler())
+
+	st_fix := c.AddCmd("state_fix", "Fix differences between state and the system", j.getCLIStateFixHandler())
+	st_fix.AddFlag("towards", "t", "os|state", "Make the system match the state (os) or the state match the system (state)", cli.TypeAlphanumeric|cli.Required)
+	st_fix.AddFlag("yes", "y", "", "Do not ask for confirmation", cli.TypeBool)
+	st_fix.AddPostValidation(func(c *cli.CLI) error {
+		if c.Flag("towards") != STATEFIX_TOWARDS_OS && c.Flag("towards") != STATEFIX_TOWARDS_STATE {
+			return errors.New("Flag --towards has to be either 'os' or 'state'")
+		}
+		return nil
+	})
+
+	st_snapshot := c.AddCmd("state_snapshot", "Save a copy of the current state", j.getCLIStateSnapshotHandler())
+	st_snapshot.AddArg("label", "LABEL", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen)
+
+	_ = c.AddCmd("state_snapshot_list", "List saved copies of the state", j.getCLIStateSnapshotListHandler())
+
+	st_rollback := c.AddCmd("state_rollback", "Restore state from a saved copy", j.getCLIStateRollbackHandler())
+	st_rollback.AddArg("snapshot", "SNAPSHOT", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.AllowDots|cli.Required)
+	st_rollback.AddFlag("show_changes", "c", "", "Show changes needed in the system to match the restored state", cli.TypeBool)
+
+	st_history := c.AddCmd("state_history", "Show history of the state and its items", j.getCLIStateHistoryHandler())
+	st_history.AddFlag("type", "t", "TYPE", "Item type (state, base, jail, jailconf, jaildir, netif, jailportfwd, jailnatpass)", cli.TypeAlphanumeric|cli.AllowUnderscore)
+	st_history.AddFlag("name", "n", "NAME", "Item name", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.AllowDots)
+	st_history.AddFlag("operation", "o", "OPERATION", "Operation, eg. add, remove, start", cli.TypeAlphanumeric|cli.AllowUnderscore)
+	st_history.AddFlag("since", "s", "TIME", "Show entries not older than TIME (RFC3339 or YYYY-MM-DD)", cli.TypeString)
+	st_history.AddFlag("until", "u", "TIME", "Show entries not newer than TIME (RFC3339 or YYYY-MM-DD for the end of that day)", cli.TypeString)
+	st_history.AddFlag("limit", "l", "NUMBER", "Show only the most recent entries", cli.TypeInt)
+	st_history.AddFlag("archived", "a", "", "Include entries moved to history archives", cli.TypeBool)
+	st_history.AddFlag("json", "j", "", "Output in JSON", cli.TypeBool)
+	st_history.AddPostValidation(func(c *cli.CLI) error {
+		for _, f := range []string{"since", "until"} {
+			if c.Flag(f) != "" {
+				_, err := ParseHistoryTime(c.Flag(f))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
 }
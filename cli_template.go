@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"github.com/nicholasgasior/go-cli"
+)
+
+func (j *Jailguard) getCLITemplateCreateHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		ow := false
+		if c.Flag("overwrite") == "true" {
+			ow = true
+		}
+		err := j.CreateTemplate(c.Arg("template"), c.Flag("from-jail"), ow)
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLITemplateListHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.ListTemplates()
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) getCLITemplateRemoveHandler() func(*cli.CLI) int {
+	fn := func(c *cli.CLI) int {
+		if c.Flag("debug") == "true" {
+			j.Debug = true
+		}
+		if c.Flag("quiet") == "true" {
+			j.Quiet = true
+		}
+
+		err := j.RemoveTemplate(c.Arg("template"))
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			return 2
+		}
+		return 0
+	}
+	return fn
+}
+
+func (j *Jailguard) AddTemplateCmds(c *cli.CLI) {
+	create := c.AddCmd("template_create", "Create template from a configured jail", j.getCLITemplateCreateHandler())
+	create.AddArg("template", "NAME", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
+	create.AddFlag("from-jail", "j", "JAIL", "Jail to capture", cli.TypeString|cli.Required)
+	create.AddFlag("overwrite", "w", "", "Overwrite if exists", cli.TypeBool)
+	create.AddPostValidation(func(c *cli.CLI) error {
+		if !IsValidJailName(c.Flag("from-jail")) {
+			return errors.New("Flag --from-jail is not a valid jail name")
+		}
+		return nil
+	})
+
+	_ = c.AddCmd("template_list", "List templates", j.getCLITemplateListHandler())
+
+	remove := c.AddCmd("template_remove", "Remove template", j.getCLITemplateRemoveHandler())
+	remove.AddArg("template", "NAME", "", cli.TypeAlphanumeric|cli.AllowUnderscore|cli.AllowHyphen|cli.Required)
+}
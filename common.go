@@ -1,10 +1,15 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -51,14 +56,89 @@ func CreateDirWithLog(p string, fn func(int, string)) error {
 	return err
 }
 
-func CmdFetchWithLog(url string, o string, fn func(int, string)) error {
-	fn(LOGDBG, fmt.Sprintf("Running 'fetch' to download %s to %s...", url, o))
-	_, err := CmdOut(fn, "fetch", url, "-o", o)
+func WriteFileAtomicWithLog(p string, b []byte, perm os.FileMode, fn func(int, string)) error {
+	d := filepath.Dir(p)
+	fn(LOGDBG, fmt.Sprintf("Writing temporary file in %s...", d))
+	tmp, err := ioutil.TempFile(d, "."+filepath.Base(p)+".")
 	if err != nil {
-		fn(LOGDBG, fmt.Sprintf("Error has occurred when downloading %s to %s", url, o))
+		fn(LOGDBG, fmt.Sprintf("Error has occurred when creating temporary file in %s: %s", d, err.Error()))
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		fn(LOGDBG, fmt.Sprintf("Error has occurred when writing temporary file %s: %s", tmp.Name(), err.Error()))
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	fn(LOGDBG, fmt.Sprintf("Renaming %s to %s...", tmp.Name(), p))
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		fn(LOGDBG, fmt.Sprintf("Error has occurred when renaming %s to %s: %s", tmp.Name(), p, err.Error()))
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// Rename has to be persisted as well so the directory gets synced
+	df, err := os.Open(d)
+	if err == nil {
+		df.Sync()
+		df.Close()
+	}
+	fn(LOGDBG, fmt.Sprintf("File %s has been written", p))
+	return nil
+}
+
+func IsURL(s string) bool {
+	for _, p := range []string{"http://", "https://"} {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasURLScheme tells whether s starts with any URL scheme, eg. ftp://, which
+// IsURL does not support
+func HasURLScheme(s string) bool {
+	re := regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*://`)
+	return re.MatchString(s)
+}
+
+func CopyFileWithLog(src string, dst string, fn func(int, string)) error {
+	fn(LOGDBG, fmt.Sprintf("Copying %s to %s...", src, dst))
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	err2 := out.Close()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		fn(LOGDBG, fmt.Sprintf("Error has occurred when copying %s to %s", src, dst))
 		return err
 	}
-	fn(LOGDBG, fmt.Sprintf("File %s has been successfully saved in %s", url, o))
 	return nil
 }
 
@@ -73,18 +153,39 @@ func CmdTarExtractWithLog(f string, d string, fn func(int, string)) error {
 	return nil
 }
 
-func CmdOut(fn func(int, string), c string, a ...string) ([]byte, error) {
-	fn(LOGDBG, fmt.Sprintf("Running command '%s %s'...", c, strings.Join(a, "")))
+func CmdTarCreateWithLog(f string, d string, excl []string, fn func(int, string)) error {
+	fn(LOGDBG, fmt.Sprintf("Running 'tar' to archive %s directory to %s...", d, f))
+	a := []string{"-c", "-p", "-z", "-f", f}
+	for _, e := range excl {
+		a = append(a, "--exclude", e)
+	}
+	a = append(a, "-C", d, ".")
+	_, err := CmdOut(fn, "tar", a...)
+	if err != nil {
+		fn(LOGDBG, fmt.Sprintf("Error has occurred when archiving %s to %s", d, f))
+		return err
+	}
+	fn(LOGDBG, fmt.Sprintf("Directory %s has been successfully archived to %s", d, f))
+	return nil
+}
+
+// CmdRunner runs external commands and returns their output. It can be
+// replaced to fake the commands.
+var CmdRunner = func(c string, a ...string) ([]byte, error) {
 	cmd := exec.Command(c, a...)
 	cmd.Stdin = os.Stdin
 	return cmd.Output()
 }
 
+func CmdOut(fn func(int, string), c string, a ...string) ([]byte, error) {
+	fn(LOGDBG, fmt.Sprintf("Running command '%s %s'...", c, strings.Join(a, " ")))
+	return CmdRunner(c, a...)
+}
+
 func CmdRun(fn func(int, string), c string, a ...string) error {
-	fn(LOGDBG, fmt.Sprintf("Running command '%s %s'...", c, strings.Join(a, "")))
-	cmd := exec.Command(c, a...)
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+	fn(LOGDBG, fmt.Sprintf("Running command '%s %s'...", c, strings.Join(a, " ")))
+	_, err := CmdRunner(c, a...)
+	return err
 }
 
 func JailExistsInOSWithLog(n string, fn func(int, string)) (bool, error) {
@@ -150,3 +251,41 @@ func IsSysCtlIsEnabled(fn func(int, string), n string) (bool, error) {
 	}
 	return true, nil
 }
+
+// BackupVersionedFile copies file f to f.vV.bak unless such backup already
+// exists
+func BackupVersionedFile(f string, v int) (string, error) {
+	p := fmt.Sprintf("%s.v%d.bak", f, v)
+	_, err := os.Stat(p)
+	if err == nil {
+		return p, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(p, b, 0600)
+	if err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+func FileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -6,23 +6,49 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
+const CONFIGSRC_DEFAULT = "default"
+const CONFIGSRC_FILE = "file"
+const CONFIGSRC_ENV = "env"
+const CONFIGSRC_FLAG = "flag"
+
+const CONFIG_ENV_PREFIX = "JAILGUARD_"
+
 type Config struct {
+	Version string `json:"version"`
+
 	PathData     string `json:"path_data"`
 	DirBases     string `json:"dir_bases"`
 	DirTemplates string `json:"dir_templates"`
 	DirState     string `json:"dir_state"`
 	DirJails     string `json:"dir_jails"`
+	DirSnapshots string `json:"dir_snapshots"`
 	DirConfigs   string `json:"dir_configs"`
 	DirTmp       string `json:"dir_tmp"`
-	FileState    string `json:"jailguard.jailstate"`
-	NetIf        string `json:"1337"`
-	PfAnchor     string `json:"jailguard"`
+	FileState    string `json:"file_state"`
+	NetIf        string `json:"net_if"`
+	PfAnchor     string `json:"pf_anchor"`
+	Mirrors      string `json:"mirrors"`
+	ZFS          string `json:"zfs"`
+
+	HistoryMaxEntries int `json:"history_max_entries"`
+	HistoryMaxAge     int `json:"history_max_age"`
 
-	Filepath string `json:"filepath"`
+	// Profiles contain values that override the ones above when a profile
+	// is selected with --profile flag
+	Profiles map[string]map[string]string `json:"profiles,omitempty"`
 
-	logger func(int, string)
+	Filepath string `json:"-"`
+
+	migratedFrom int
+	backupPath   string
+	sources      map[string]string
+	logger       func(int, string)
 }
 
 func (c *Config) SetLogger(f func(int, string)) {
@@ -30,95 +56,178 @@ func (c *Config) SetLogger(f func(int, string)) {
 }
 
 func (c *Config) SetDefaultValues() {
-	c.PathData = "/usr/local/jailguard"
-	c.DirBases = "bases"
-	c.DirTemplates = "templates"
-	c.DirState = "state"
-	c.DirJails = "jails"
-	c.DirConfigs = "configs"
-	c.DirTmp = "tmp"
-	c.FileState = "jailguard.jailstate"
-	c.NetIf = "1337"
-	c.PfAnchor = "jailguard"
+	c.Version = strconv.Itoa(CONFIG_VERSION)
+	c.sources = map[string]string{}
+	for _, ck := range configKeys {
+		ck.Set(c, ck.Default)
+		c.sources[ck.Name] = CONFIGSRC_DEFAULT
+	}
 }
 
-func (c *Config) Set(k string, v string) error {
-	// TODO: Validation
-	if k == "path_data" {
-		c.PathData = v
-	}
-	if k == "dir_bases" {
-		c.DirBases = v
+// GetDirPath returns path of directory d which is either absolute or relative
+// to path_data
+func (c *Config) GetDirPath(d string) string {
+	if filepath.IsAbs(d) {
+		return d
 	}
-	if k == "dir_templates" {
-		c.DirTemplates = v
-	}
-	if k == "dir_state" {
-		c.DirState = v
-	}
-	if k == "dir_jails" {
-		c.DirJails = v
+	return c.PathData + "/" + d
+}
+
+func (c *Config) GetMirrors() []string {
+	l := []string{}
+	for _, u := range strings.Split(c.Mirrors, ",") {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u != "" {
+			l = append(l, u)
+		}
 	}
-	if k == "dir_configs" {
-		c.DirConfigs = v
+	return l
+}
+
+func (c *Config) GetMigratedFrom() (int, string) {
+	return c.migratedFrom, c.backupPath
+}
+
+// GetSource returns where value of key k comes from
+func (c *Config) GetSource(k string) string {
+	if c.sources[k] == "" {
+		return CONFIGSRC_DEFAULT
 	}
-	if k == "dir_tmp" {
-		c.DirTmp = v
+	return c.sources[k]
+}
+
+// SetFileFromFlag marks values read from the file as set by a flag when the
+// file has been given with --config
+func (c *Config) SetFileFromFlag() {
+	for k, src := range c.sources {
+		if src == CONFIGSRC_FILE {
+			c.sources[k] = CONFIGSRC_FLAG
+		}
 	}
-	if k == "file_state" {
-		c.FileState = v
+}
+
+func GetConfigEnvName(k string) string {
+	return CONFIG_ENV_PREFIX + strings.ToUpper(k)
+}
+
+// ApplyEnv overrides values with JAILGUARD_* environment variables, eg.
+// JAILGUARD_PATH_DATA
+func (c *Config) ApplyEnv() error {
+	for _, ck := range configKeys {
+		v, ok := os.LookupEnv(GetConfigEnvName(ck.Name))
+		if !ok {
+			continue
+		}
+		err := ck.Set(c, v)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error in %s environment variable: %s", GetConfigEnvName(ck.Name), err.Error()))
+		}
+		c.sources[ck.Name] = CONFIGSRC_ENV
 	}
-	if k == "net_if" {
-		c.NetIf = v
+	return nil
+}
+
+func IsValidConfigProfileName(n string) bool {
+	re := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-]{0,31}$`)
+	return re.MatchString(n)
+}
+
+// ApplyProfile switches to profile n. Each profile has its own data
+// directory and pf anchor unless they are set in the profile. It has to be
+// called before ApplyEnv so that environment variables take precedence.
+func (c *Config) ApplyProfile(n string) error {
+	if !IsValidConfigProfileName(n) {
+		return errors.New(fmt.Sprintf("Invalid profile name '%s'", n))
 	}
-	if k == "pf_anchor" {
-		c.PfAnchor = v
+
+	c.PathData = c.PathData + "/profiles/" + n
+	c.PfAnchor = c.PfAnchor + "_" + n
+	c.sources["path_data"] = CONFIGSRC_FLAG
+	c.sources["pf_anchor"] = CONFIGSRC_FLAG
+
+	for k, v := range c.Profiles[n] {
+		ck := GetConfigKey(k)
+		if ck == nil {
+			return errors.New(fmt.Sprintf("Unknown config key '%s' in profile %s", k, n))
+		}
+		err := ck.Set(c, v)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error in profile %s: %s", n, err.Error()))
+		}
+		c.sources[k] = CONFIGSRC_FLAG
 	}
 	return nil
 }
 
-func (c *Config) Print(f *os.File, k string) {
-	if k == "" || k == "path_data" {
-		fmt.Fprintf(f, "path_data %s\n", c.PathData)
-	}
-	if k == "" || k == "dir_bases" {
-		fmt.Fprintf(f, "dir_bases %s\n", c.DirBases)
+// SetInProfile sets value of key k that is used only when profile n is
+// selected
+func (c *Config) SetInProfile(n string, k string, v string) error {
+	if !IsValidConfigProfileName(n) {
+		return errors.New(fmt.Sprintf("Invalid profile name '%s'", n))
 	}
-	if k == "" || k == "dir_templates" {
-		fmt.Fprintf(f, "dir_templates %s\n", c.DirTemplates)
+	ck := GetConfigKey(k)
+	if ck == nil {
+		return errors.New(fmt.Sprintf("Unknown config key '%s'. Run config_describe to list available keys", k))
 	}
-	if k == "" || k == "dir_state" {
-		fmt.Fprintf(f, "dir_state %s\n", c.DirState)
+	err := ck.Validate(v)
+	if err != nil {
+		return err
 	}
-	if k == "" || k == "dir_jails" {
-		fmt.Fprintf(f, "dir_jails %s\n", c.DirJails)
+	if c.Profiles == nil {
+		c.Profiles = map[string]map[string]string{}
 	}
-	if k == "" || k == "dir_configs" {
-		fmt.Fprintf(f, "dir_configs %s\n", c.DirConfigs)
+	if c.Profiles[n] == nil {
+		c.Profiles[n] = map[string]string{}
 	}
-	if k == "" || k == "dir_tmp" {
-		fmt.Fprintf(f, "dir_tmp %s\n", c.DirTmp)
+	c.Profiles[n][k] = v
+	return nil
+}
+
+func (c *Config) Set(k string, v string) error {
+	ck := GetConfigKey(k)
+	if ck == nil {
+		return errors.New(fmt.Sprintf("Unknown config key '%s'. Run config_describe to list available keys", k))
 	}
-	if k == "" || k == "file_state" {
-		fmt.Fprintf(f, "file_state %s\n", c.FileState)
+	return ck.Set(c, v)
+}
+
+func (c *Config) Validate() error {
+	for _, ck := range configKeys {
+		err := ck.Validate(ck.Get(c))
+		if err != nil {
+			return err
+		}
 	}
-	if k == "" || k == "net_if" {
-		fmt.Fprintf(f, "net_if %s\n", c.NetIf)
+	return nil
+}
+
+func (c *Config) Print(f *os.File, k string, src bool) error {
+	if k != "" && GetConfigKey(k) == nil {
+		return errors.New(fmt.Sprintf("Unknown config key '%s'. Run config_describe to list available keys", k))
 	}
-	if k == "" || k == "pf_anchor" {
-		fmt.Fprintf(f, "pf_anchor %s\n", c.PfAnchor)
+	for _, ck := range configKeys {
+		if k != "" && k != ck.Name {
+			continue
+		}
+		if src {
+			fmt.Fprintf(f, "%s %s (%s)\n", ck.Name, ck.Get(c), c.GetSource(ck.Name))
+		} else {
+			fmt.Fprintf(f, "%s %s\n", ck.Name, ck.Get(c))
+		}
 	}
+	return nil
 }
 
 func (c *Config) Save() error {
 	c.logger(LOGDBG, "Generating config JSON...")
-	o, err := json.Marshal(c)
+	c.Version = strconv.Itoa(CONFIG_VERSION)
+	o, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		c.logger(LOGDBG, fmt.Sprintf("Error has occurred while generating config JSON: %s", err.Error()))
 		return err
 	}
 	c.logger(LOGDBG, fmt.Sprintf("Writing the config to %s...", c.Filepath))
-	err = ioutil.WriteFile(c.Filepath, o, 0644)
+	err = WriteFileAtomicWithLog(c.Filepath, o, 0644, c.logger)
 	if err != nil {
 		return err
 	}
@@ -143,10 +252,35 @@ func NewConfig(f string) (*Config, error) {
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Error has occurred while getting config file: %s", err.Error()))
 	}
+	b, v, err := migrateConfig(b)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error has occurred while migrating config file: %s", err.Error()))
+	}
+	if v > 0 {
+		c.backupPath, err = BackupVersionedFile(f, v)
+		if err == nil {
+			err = WriteFileAtomicWithLog(f, b, 0644, func(int, string) {})
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error has occurred while migrating config file: %s", err.Error()))
+		}
+		c.migratedFrom = v
+	}
+
+	// Keys missing from the file keep their default values
+	c.SetDefaultValues()
 	err = json.Unmarshal(b, c)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Error has occurred while getting config file: %s", err.Error()))
 	}
 
+	m := map[string]interface{}{}
+	_ = json.Unmarshal(b, &m)
+	for _, ck := range configKeys {
+		if _, ok := m[ck.Name]; ok {
+			c.sources[ck.Name] = CONFIGSRC_FILE
+		}
+	}
+
 	return c, nil
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const CONFIG_VERSION = 2
+
+// Files written before the config was versioned used wrong JSON keys that
+// were the default values of the fields
+var configV1Keys = map[string]string{
+	"jailguard.jailstate": "file_state",
+	"1337":                "net_if",
+	"jailguard":           "pf_anchor",
+}
+
+func getConfigFileVersion(m map[string]interface{}) (int, error) {
+	v, ok := m["version"]
+	if !ok {
+		return 1, nil
+	}
+	s, _ := v.(string)
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid config version '%v'", v))
+	}
+	return i, nil
+}
+
+func migrateConfigV1(m map[string]interface{}) {
+	for o, n := range configV1Keys {
+		v, ok := m[o]
+		if !ok {
+			continue
+		}
+		if _, ok := m[n]; !ok {
+			m[n] = v
+		}
+		delete(m, o)
+	}
+	delete(m, "filepath")
+}
+
+// migrateConfig returns config JSON converted to the current version. When
+// nothing has to be done then 0 is returned as the previous version.
+func migrateConfig(b []byte) ([]byte, int, error) {
+	m := map[string]interface{}{}
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	v, err := getConfigFileVersion(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v > CONFIG_VERSION {
+		return nil, 0, errors.New(fmt.Sprintf("Config version %d is newer than %d supported by this jailguard", v, CONFIG_VERSION))
+	}
+	if v == CONFIG_VERSION {
+		return b, 0, nil
+	}
+
+	if v == 1 {
+		migrateConfigV1(m)
+	}
+	m["version"] = strconv.Itoa(CONFIG_VERSION)
+
+	o, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, 0, err
+	}
+	return o, v, nil
+}
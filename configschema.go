@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const CONFIGTYPE_STRING = "string"
+const CONFIGTYPE_INT = "int"
+
+// ConfigKey describes a single config key. Value is always passed around as
+// a string and converted according to the type.
+type ConfigKey struct {
+	Name        string
+	Type        string
+	Default     string
+	Description string
+	validate    func(string) error
+	str         func(*Config) *string
+	num         func(*Config) *int
+}
+
+func validateConfigAbsPath(v string) error {
+	if !filepath.IsAbs(v) || filepath.Clean(v) != v {
+		return errors.New("has to be a clean absolute path")
+	}
+	return nil
+}
+
+func validateConfigName(v string) error {
+	re := regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.\-]{0,254}$`)
+	if !re.MatchString(v) || v == "." || v == ".." {
+		return errors.New("has to be a file name without slashes")
+	}
+	return nil
+}
+
+func validateConfigNameOrAbsPath(v string) error {
+	if filepath.IsAbs(v) {
+		return validateConfigAbsPath(v)
+	}
+	err := validateConfigName(v)
+	if err != nil {
+		return errors.New("has to be a file name without slashes or a clean absolute path")
+	}
+	return nil
+}
+
+func validateConfigURLList(v string) error {
+	for _, u := range strings.Split(v, ",") {
+		u = strings.TrimSpace(u)
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") || len(u) < 9 || strings.ContainsAny(u, " \t") {
+			return errors.New("has to be a comma separated list of http or https URLs")
+		}
+	}
+	return nil
+}
+
+func validateConfigOneOf(vs ...string) func(string) error {
+	return func(v string) error {
+		for _, v2 := range vs {
+			if v == v2 {
+				return nil
+			}
+		}
+		return errors.New(fmt.Sprintf("has to be one of: %s", strings.Join(vs, ", ")))
+	}
+}
+
+func validateConfigIfName(v string) error {
+	re := regexp.MustCompile(`^[a-zA-Z0-9_.]{1,15}$`)
+	if !re.MatchString(v) {
+		return errors.New("has to be a valid network interface name of at most 15 characters")
+	}
+	return nil
+}
+
+func validateConfigAnchor(v string) error {
+	re := regexp.MustCompile(`^[a-zA-Z0-9_\-]+(/[a-zA-Z0-9_\-]+)*$`)
+	if !re.MatchString(v) || len(v) > 63 {
+		return errors.New("has to be a valid pf anchor name")
+	}
+	return nil
+}
+
+func validateConfigNonNegative(v string) error {
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return errors.New("has to be a number equal or greater than 0")
+	}
+	return nil
+}
+
+var configKeys = []*ConfigKey{
+	{Name: "path_data", Type: CONFIGTYPE_STRING, Default: "/usr/local/jailguard", Description: "Directory where all the jailguard data is kept", validate: validateConfigAbsPath, str: func(c *Config) *string { return &c.PathData }},
+	{Name: "dir_bases", Type: CONFIGTYPE_STRING, Default: "bases", Description: "Directory within path_data, or an absolute path, with downloaded bases", validate: validateConfigNameOrAbsPath, str: func(c *Config) *string { return &c.DirBases }},
+	{Name: "dir_templates", Type: CONFIGTYPE_STRING, Default: "templates", Description: "Directory within path_data with jail templates", validate: validateConfigName, str: func(c *Config) *string { return &c.DirTemplates }},
+	{Name: "dir_state", Type: CONFIGTYPE_STRING, Default: "state", Description: "Directory within path_data with the state file, its snapshots and history archives", validate: validateConfigName, str: func(c *Config) *string { return &c.DirState }},
+	{Name: "dir_jails", Type: CONFIGTYPE_STRING, Default: "jails", Description: "Directory within path_data, or an absolute path, with jail sources", validate: validateConfigNameOrAbsPath, str: func(c *Config) *string { return &c.DirJails }},
+	{Name: "dir_snapshots", Type: CONFIGTYPE_STRING, Default: "snapshots", Description: "Directory within path_data, or an absolute path, with tarball snapshots of jails that are not on ZFS", validate: validateConfigNameOrAbsPath, str: func(c *Config) *string { return &c.DirSnapshots }},
+	{Name: "dir_configs", Type: CONFIGTYPE_STRING, Default: "configs", Description: "Directory within path_data with jail config and pf rules files", validate: validateConfigName, str: func(c *Config) *string { return &c.DirConfigs }},
+	{Name: "dir_tmp", Type: CONFIGTYPE_STRING, Default: "tmp", Description: "Directory within path_data for temporary files", validate: validateConfigName, str: func(c *Config) *string { return &c.DirTmp }},
+	{Name: "file_state", Type: CONFIGTYPE_STRING, Default: "jailguard.jailstate", Description: "Name of the state file in dir_state", validate: validateConfigName, str: func(c *Config) *string { return &c.FileState }},
+	{Name: "net_if", Type: CONFIGTYPE_STRING, Default: "1337", Description: "Name of the network interface", validate: validateConfigIfName, str: func(c *Config) *string { return &c.NetIf }},
+	{Name: "pf_anchor", Type: CONFIGTYPE_STRING, Default: "jailguard", Description: "pf anchor under which jail rules are loaded", validate: validateConfigAnchor, str: func(c *Config) *string { return &c.PfAnchor }},
+	{Name: "mirrors", Type: CONFIGTYPE_STRING, Default: "https://download.freebsd.org/ftp,https://ftp.freebsd.org/pub/FreeBSD", Description: "Comma separated list of FreeBSD mirrors to download bases from. They are tried in order", validate: validateConfigURLList, str: func(c *Config) *string { return &c.Mirrors }},
+	{Name: "zfs", Type: CONFIGTYPE_STRING, Default: "auto", Description: "Whether to create ZFS datasets for bases and jails when their directories are on ZFS ('auto') or always use plain directories ('off')", validate: validateConfigOneOf("auto", "off"), str: func(c *Config) *string { return &c.ZFS }},
+	{Name: "history_max_entries", Type: CONFIGTYPE_INT, Default: "1000", Description: "Number of history entries kept in the state for each item, older ones are archived. 0 means no limit", validate: validateConfigNonNegative, num: func(c *Config) *int { return &c.HistoryMaxEntries }},
+	{Name: "history_max_age", Type: CONFIGTYPE_INT, Default: "0", Description: "Number of days history entries are kept in the state, older ones are archived. 0 means no limit", validate: validateConfigNonNegative, num: func(c *Config) *int { return &c.HistoryMaxAge }},
+}
+
+func GetConfigKey(n string) *ConfigKey {
+	for _, ck := range configKeys {
+		if ck.Name == n {
+			return ck
+		}
+	}
+	return nil
+}
+
+func (ck *ConfigKey) Get(c *Config) string {
+	if ck.Type == CONFIGTYPE_INT {
+		return strconv.Itoa(*ck.num(c))
+	}
+	return *ck.str(c)
+}
+
+func (ck *ConfigKey) Validate(v string) error {
+	if ck.validate == nil {
+		return nil
+	}
+	err := ck.validate(v)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid value '%s' of %s: %s", v, ck.Name, err.Error()))
+	}
+	return nil
+}
+
+func (ck *ConfigKey) Set(c *Config, v string) error {
+	err := ck.Validate(v)
+	if err != nil {
+		return err
+	}
+	if ck.Type == CONFIGTYPE_INT {
+		i, _ := strconv.Atoi(v)
+		*ck.num(c) = i
+		return nil
+	}
+	*ck.str(c) = v
+	return nil
+}
+
+func PrintConfigKeys(f *os.File) {
+	for _, ck := range configKeys {
+		fmt.Fprintf(f, "%s (%s, default: %s)\n", ck.Name, ck.Type, ck.Default)
+		fmt.Fprintf(f, "    %s\n", ck.Description)
+	}
+}
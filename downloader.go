@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+const DOWNLOADER_PART_SUFFIX = ".part"
+const DOWNLOADER_DEFAULT_RETRIES = 5
+const DOWNLOADER_DEFAULT_BACKOFF = 2 * time.Second
+const DOWNLOADER_MAX_BACKOFF = 60 * time.Second
+const DOWNLOADER_IDLE_TIMEOUT = 60 * time.Second
+const DOWNLOADER_PROGRESS_INTERVAL = 2 * time.Second
+
+// DownloadHTTPError is returned when server responds with an unexpected
+// status. Only server errors are worth retrying.
+type DownloadHTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *DownloadHTTPError) Error() string {
+	return fmt.Sprintf("Server responded with %d for %s", e.StatusCode, e.URL)
+}
+
+func (e *DownloadHTTPError) IsRetryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// DownloadProgressEvent is printed as JSON line when progress is reported in
+// JSON
+type DownloadProgressEvent struct {
+	Event string  `json:"event"`
+	URL   string  `json:"url"`
+	Bytes int64   `json:"bytes"`
+	Total int64   `json:"total"`
+	Rate  float64 `json:"rate"`
+	ETA   int64   `json:"eta"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Downloader gets files over HTTP into a temporary file next to the
+// destination. Interrupted downloads are resumed with Range requests. The
+// temporary file is left for the caller to verify and rename.
+type Downloader struct {
+	Retries     int
+	Backoff     time.Duration
+	IdleTimeout time.Duration
+
+	client       *http.Client
+	progress     *os.File
+	progressJSON bool
+	logger       func(int, string)
+}
+
+func (dl *Downloader) SetLogger(f func(int, string)) {
+	dl.logger = f
+}
+
+// SetProgress sets where progress is printed to, nil disables it
+func (dl *Downloader) SetProgress(f *os.File, asJSON bool) {
+	dl.progress = f
+	dl.progressJSON = asJSON
+}
+
+func GetDownloadPartPath(p string) string {
+	return p + DOWNLOADER_PART_SUFFIX
+}
+
+// Fetch downloads url into temporary file of p retrying with backoff
+func (dl *Downloader) Fetch(url string, p string) error {
+	tmp := GetDownloadPartPath(p)
+	wait := dl.Backoff
+
+	var err error
+	for i := 0; i <= dl.Retries; i++ {
+		if i > 0 {
+			dl.logger(LOGINF, fmt.Sprintf("Downloading %s has failed: %s. Retrying in %s...", url, err.Error(), wait))
+			dl.printEvent(&DownloadProgressEvent{Event: "retry", URL: url, Error: err.Error()})
+			time.Sleep(wait)
+			wait *= 2
+			if wait > DOWNLOADER_MAX_BACKOFF {
+				wait = DOWNLOADER_MAX_BACKOFF
+			}
+		}
+
+		err = dl.fetchOnce(url, tmp)
+		if err == nil {
+			return nil
+		}
+		if e, ok := err.(*DownloadHTTPError); ok && !e.IsRetryable() {
+			break
+		}
+	}
+	dl.printEvent(&DownloadProgressEvent{Event: "failed", URL: url, Error: err.Error()})
+	return err
+}
+
+func (dl *Downloader) fetchOnce(url string, tmp string) error {
+	var off int64
+	fi, err := os.Stat(tmp)
+	if err == nil {
+		off = fi.Size()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := time.AfterFunc(dl.IdleTimeout, cancel)
+	defer idle.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if off > 0 {
+		dl.logger(LOGDBG, fmt.Sprintf("Resuming download of %s from byte %d...", url, off))
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	} else {
+		dl.logger(LOGDBG, fmt.Sprintf("Downloading %s to %s...", url, tmp))
+	}
+
+	resp, err := dl.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusOK:
+		off = 0
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Whole file has been downloaded already, verification will tell
+		// whether it is correct
+		if off > 0 {
+			return nil
+		}
+		return &DownloadHTTPError{URL: url, StatusCode: resp.StatusCode}
+	default:
+		return &DownloadHTTPError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	var total int64 = -1
+	if resp.ContentLength >= 0 {
+		total = off + resp.ContentLength
+	}
+
+	f, err := os.OpenFile(tmp, flags, 0644)
+	if err != nil {
+		return err
+	}
+	pw := &downloadProgressWriter{dl: dl, url: url, off: off, bytes: off, total: total, started: time.Now(), printed: time.Now(), idle: idle}
+	dl.printEvent(&DownloadProgressEvent{Event: "start", URL: url, Bytes: off, Total: total})
+	_, err = io.Copy(f, io.TeeReader(resp.Body, pw))
+	if err == nil {
+		err = f.Sync()
+	}
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	if total >= 0 && pw.bytes != total {
+		return errors.New(fmt.Sprintf("Downloaded %d bytes out of %d", pw.bytes, total))
+	}
+
+	pw.print("done")
+	dl.logger(LOGDBG, fmt.Sprintf("File %s has been successfully saved in %s", url, tmp))
+	return nil
+}
+
+func (dl *Downloader) printEvent(ev *DownloadProgressEvent) {
+	if dl.progress == nil {
+		return
+	}
+	if dl.progressJSON {
+		b, err := json.Marshal(ev)
+		if err == nil {
+			fmt.Fprintf(dl.progress, "%s\n", b)
+		}
+		return
+	}
+	if ev.Event != "progress" && ev.Event != "done" {
+		return
+	}
+	s := fmt.Sprintf("* %s: %s", path.Base(ev.URL), formatByteSize(ev.Bytes))
+	if ev.Total >= 0 {
+		s += fmt.Sprintf(" / %s (%d%%)", formatByteSize(ev.Total), ev.Bytes*100/maxInt64(ev.Total, 1))
+	}
+	s += fmt.Sprintf(" %s/s", formatByteSize(int64(ev.Rate)))
+	if ev.Event == "progress" && ev.ETA >= 0 {
+		s += fmt.Sprintf(" ETA %s", time.Duration(ev.ETA)*time.Second)
+	}
+	fmt.Fprintf(dl.progress, "%s\n", s)
+}
+
+type downloadProgressWriter struct {
+	dl      *Downloader
+	url     string
+	off     int64
+	bytes   int64
+	total   int64
+	started time.Time
+	printed time.Time
+	idle    *time.Timer
+}
+
+func (pw *downloadProgressWriter) Write(b []byte) (int, error) {
+	pw.bytes += int64(len(b))
+	pw.idle.Reset(pw.dl.IdleTimeout)
+	if time.Since(pw.printed) >= DOWNLOADER_PROGRESS_INTERVAL {
+		pw.print("progress")
+	}
+	return len(b), nil
+}
+
+func (pw *downloadProgressWriter) print(ev string) {
+	pw.printed = time.Now()
+	rate := float64(pw.bytes-pw.off) / time.Since(pw.started).Seconds()
+	var eta int64 = -1
+	if pw.total >= 0 && rate > 0 {
+		eta = int64(float64(pw.total-pw.bytes) / rate)
+	}
+	pw.dl.printEvent(&DownloadProgressEvent{Event: ev, URL: pw.url, Bytes: pw.bytes, Total: pw.total, Rate: rate, ETA: eta})
+}
+
+func formatByteSize(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func NewDownloader() *Downloader {
+	dl := &Downloader{
+		Retries:     DOWNLOADER_DEFAULT_RETRIES,
+		Backoff:     DOWNLOADER_DEFAULT_BACKOFF,
+		IdleTimeout: DOWNLOADER_IDLE_TIMEOUT,
+		client:      &http.Client{},
+	}
+	return dl
+}
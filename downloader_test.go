@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testDownloadContent = bytes.Repeat([]byte("0123456789"), 1000)
+
+// testDownloadServer serves testDownloadContent with Range support after
+// failing with status fail for the first failures requests
+type testDownloadServer struct {
+	fail     int
+	failures int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *testDownloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	n := len(s.ranges)
+	s.mu.Unlock()
+	if n <= s.failures {
+		w.WriteHeader(s.fail)
+		return
+	}
+	http.ServeContent(w, r, "base.txz", time.Time{}, bytes.NewReader(testDownloadContent))
+}
+
+func newTestDownloader() *Downloader {
+	dl := NewDownloader()
+	dl.SetLogger(func(int, string) {})
+	dl.Retries = 3
+	dl.Backoff = 10 * time.Millisecond
+	return dl
+}
+
+func newTestDownloadPath(t *testing.T) (string, func()) {
+	d, err := ioutil.TempDir("", "jailguard-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d + "/base.txz", func() {
+		os.RemoveAll(d)
+	}
+}
+
+func checkTestDownload(t *testing.T, p string) {
+	b, err := ioutil.ReadFile(GetDownloadPartPath(p))
+	if err != nil {
+		t.Fatalf("Cannot read downloaded file: %s", err.Error())
+	}
+	if !bytes.Equal(b, testDownloadContent) {
+		t.Errorf("Downloaded file has %d bytes, want %d", len(b), len(testDownloadContent))
+	}
+}
+
+func TestDownloaderFetch(t *testing.T) {
+	s := &testDownloadServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	p, cleanup := newTestDownloadPath(t)
+	defer cleanup()
+
+	err := newTestDownloader().Fetch(srv.URL+"/base.txz", p)
+	if err != nil {
+		t.Fatalf("Fetch returned error: %s", err.Error())
+	}
+	checkTestDownload(t, p)
+	if len(s.ranges) != 1 || s.ranges[0] != "" {
+		t.Errorf("Unexpected requests with ranges %v", s.ranges)
+	}
+}
+
+func TestDownloaderFetchResumes(t *testing.T) {
+	s := &testDownloadServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	p, cleanup := newTestDownloadPath(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(GetDownloadPartPath(p), testDownloadContent[:4000], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = newTestDownloader().Fetch(srv.URL+"/base.txz", p)
+	if err != nil {
+		t.Fatalf("Fetch returned error: %s", err.Error())
+	}
+	checkTestDownload(t, p)
+	if len(s.ranges) != 1 || s.ranges[0] != "bytes=4000-" {
+		t.Errorf("Unexpected requests with ranges %v", s.ranges)
+	}
+}
+
+func TestDownloaderFetchRangeNotSatisfiable(t *testing.T) {
+	s := &testDownloadServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	p, cleanup := newTestDownloadPath(t)
+	defer cleanup()
+
+	// Whole file has been downloaded before so server responds with 416
+	err := ioutil.WriteFile(GetDownloadPartPath(p), testDownloadContent, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = newTestDownloader().Fetch(srv.URL+"/base.txz", p)
+	if err != nil {
+		t.Fatalf("Fetch returned error: %s", err.Error())
+	}
+	checkTestDownload(t, p)
+	if len(s.ranges) != 1 {
+		t.Errorf("Fetch has sent %d requests, want 1", len(s.ranges))
+	}
+
+	// Without any downloaded part 416 is an error
+	s2 := &testDownloadServer{fail: http.StatusRequestedRangeNotSatisfiable, failures: 10}
+	srv2 := httptest.NewServer(s2)
+	defer srv2.Close()
+	p2, cleanup2 := newTestDownloadPath(t)
+	defer cleanup2()
+
+	err = newTestDownloader().Fetch(srv2.URL+"/base.txz", p2)
+	if e, ok := err.(*DownloadHTTPError); !ok || e.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Fetch returned %v, want DownloadHTTPError with 416", err)
+	}
+	if len(s2.ranges) != 1 {
+		t.Errorf("Fetch has sent %d requests, want 1", len(s2.ranges))
+	}
+}
+
+func TestDownloaderFetchRetries(t *testing.T) {
+	s := &testDownloadServer{fail: http.StatusServiceUnavailable, failures: 2}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	p, cleanup := newTestDownloadPath(t)
+	defer cleanup()
+
+	started := time.Now()
+	err := newTestDownloader().Fetch(srv.URL+"/base.txz", p)
+	if err != nil {
+		t.Fatalf("Fetch returned error: %s", err.Error())
+	}
+	checkTestDownload(t, p)
+	if len(s.ranges) != 3 {
+		t.Errorf("Fetch has sent %d requests, want 3", len(s.ranges))
+	}
+	// Backoff doubles after each failure
+	if time.Since(started) < 30*time.Millisecond {
+		t.Errorf("Fetch has retried after %s, want at least 30ms", time.Since(started))
+	}
+}
+
+func TestDownloaderFetchGivesUp(t *testing.T) {
+	s := &testDownloadServer{fail: http.StatusInternalServerError, failures: 10}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	p, cleanup := newTestDownloadPath(t)
+	defer cleanup()
+
+	err := newTestDownloader().Fetch(srv.URL+"/base.txz", p)
+	if err == nil {
+		t.Fatal("Fetch has not returned error")
+	}
+	if len(s.ranges) != 4 {
+		t.Errorf("Fetch has sent %d requests, want 4", len(s.ranges))
+	}
+
+	// Client errors are not retried
+	s2 := &testDownloadServer{fail: http.StatusNotFound, failures: 10}
+	srv2 := httptest.NewServer(s2)
+	defer srv2.Close()
+
+	err = newTestDownloader().Fetch(srv2.URL+"/base.txz", p)
+	if err == nil {
+		t.Fatal("Fetch has not returned error")
+	}
+	if len(s2.ranges) != 1 {
+		t.Errorf("Fetch has sent %d requests, want 1", len(s2.ranges))
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+type FileLock struct {
+	Filepath string
+	file     *os.File
+	logger   func(int, string)
+}
+
+func (fl *FileLock) SetLogger(f func(int, string)) {
+	fl.logger = f
+}
+
+func (fl *FileLock) Lock() error {
+	if fl.file != nil {
+		return nil
+	}
+
+	d := filepath.Dir(fl.Filepath)
+	_, _, err := StatWithLog(d, fl.logger)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.New("Error has occurred while getting lock file directory")
+		}
+		err = CreateDirWithLog(d, fl.logger)
+		if err != nil {
+			return errors.New("Error has occurred while creating lock file directory")
+		}
+	}
+
+	fl.logger(LOGDBG, fmt.Sprintf("Opening lock file %s...", fl.Filepath))
+	f, err := os.OpenFile(fl.Filepath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.New("Error has occurred while opening lock file: " + err.Error())
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		fl.logger(LOGINF, fmt.Sprintf("Waiting for another jailguard process to release %s...", fl.Filepath))
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return errors.New("Error has occurred while locking file: " + err.Error())
+	}
+
+	fl.file = f
+	fl.logger(LOGDBG, fmt.Sprintf("Lock %s has been acquired", fl.Filepath))
+	return nil
+}
+
+func (fl *FileLock) Unlock() error {
+	if fl.file == nil {
+		return nil
+	}
+
+	err := syscall.Flock(int(fl.file.Fd()), syscall.LOCK_UN)
+	fl.file.Close()
+	fl.file = nil
+	if err != nil {
+		return errors.New("Error has occurred while unlocking file: " + err.Error())
+	}
+	fl.logger(LOGDBG, fmt.Sprintf("Lock %s has been released", fl.Filepath))
+	return nil
+}
+
+func NewFileLock(p string) *FileLock {
+	fl := &FileLock{Filepath: p}
+	return fl
+}
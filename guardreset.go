@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const GUARDRESET_NATPASS = "natpass"
+const GUARDRESET_PORTFWD = "portfwd"
+const GUARDRESET_JAIL = "jail"
+const GUARDRESET_NETIF = "netif"
+const GUARDRESET_BASE = "base"
+
+// GuardReset is a list of actions that remove resources of the selected
+// classes. Actions have to be added in the order they should be run.
+type GuardReset struct {
+	*ActionPlan
+	Classes map[string]bool
+}
+
+func (gr *GuardReset) Has(c string) bool {
+	return gr.Classes[c]
+}
+
+func (gr *GuardReset) Print(f *os.File) {
+	if len(gr.Actions) == 0 {
+		fmt.Fprintf(f, "Nothing to remove\n")
+		return
+	}
+	gr.PrintActions(f, "Actions to be performed")
+}
+
+func NewGuardReset(cls []string) *GuardReset {
+	gr := &GuardReset{ActionPlan: NewActionPlan()}
+	gr.Classes = map[string]bool{}
+	for _, c := range cls {
+		gr.Classes[c] = true
+	}
+	return gr
+}
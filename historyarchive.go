@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const HISTORYARCHIVE_PREFIX = "history-"
+const HISTORYARCHIVE_SUFFIX = ".jsonl.gz"
+
+// HistoryArchive keeps history entries removed from the state in gzipped
+// files with one JSON entry per line. A new file is started every month and
+// entries are appended to it as separate gzip members.
+type HistoryArchive struct {
+	Dirpath string
+
+	logger func(int, string)
+}
+
+func (ha *HistoryArchive) SetLogger(f func(int, string)) {
+	ha.logger = f
+}
+
+func (ha *HistoryArchive) getFilePath(t time.Time) string {
+	return filepath.Join(ha.Dirpath, HISTORYARCHIVE_PREFIX+t.Format("200601")+HISTORYARCHIVE_SUFFIX)
+}
+
+func (ha *HistoryArchive) Append(hs []*HistoryEntry) error {
+	if len(hs) == 0 {
+		return nil
+	}
+
+	_, _, err := StatWithLog(ha.Dirpath, ha.logger)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.New("Error has occurred while getting history archive directory")
+		}
+		err = CreateDirWithLog(ha.Dirpath, ha.logger)
+		if err != nil {
+			return errors.New("Error has occurred while creating history archive directory")
+		}
+	}
+
+	p := ha.getFilePath(time.Now())
+	ha.logger(LOGDBG, fmt.Sprintf("Archiving %d history entries in %s...", len(hs), p))
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.New("Error has occurred while opening history archive: " + err.Error())
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	for _, he := range hs {
+		err = enc.Encode(he)
+		if err != nil {
+			return errors.New("Error has occurred while writing history archive: " + err.Error())
+		}
+	}
+	err = zw.Close()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		return errors.New("Error has occurred while writing history archive: " + err.Error())
+	}
+	return nil
+}
+
+func (ha *HistoryArchive) getFilePaths() ([]string, error) {
+	l := []string{}
+	fis, err := ioutil.ReadDir(ha.Dirpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, errors.New("Error has occurred while reading history archive directory: " + err.Error())
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() && strings.HasPrefix(fi.Name(), HISTORYARCHIVE_PREFIX) && strings.HasSuffix(fi.Name(), HISTORYARCHIVE_SUFFIX) {
+			l = append(l, filepath.Join(ha.Dirpath, fi.Name()))
+		}
+	}
+	sort.Strings(l)
+	return l, nil
+}
+
+func (ha *HistoryArchive) readFile(p string) ([]*HistoryEntry, error) {
+	ha.logger(LOGDBG, fmt.Sprintf("Reading history archive %s...", p))
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	hs := []*HistoryEntry{}
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		he := &HistoryEntry{}
+		err = json.Unmarshal(sc.Bytes(), he)
+		if err != nil {
+			return nil, err
+		}
+		hs = append(hs, he)
+	}
+	return hs, sc.Err()
+}
+
+func (ha *HistoryArchive) ReadAll() ([]*HistoryEntry, error) {
+	ps, err := ha.getFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	hs := []*HistoryEntry{}
+	for _, p := range ps {
+		l, err := ha.readFile(p)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error has occurred while reading history archive %s: %s", p, err.Error()))
+		}
+		hs = append(hs, l...)
+	}
+	return hs, nil
+}
+
+func NewHistoryArchive(dir string) *HistoryArchive {
+	ha := &HistoryArchive{Dirpath: dir}
+	return ha
+}
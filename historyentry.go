@@ -1,15 +1,60 @@
 package main
 
 import (
-//"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
 )
 
+const HISTORY_RESULT_OK = "ok"
+const HISTORY_RESULT_ERROR = "error"
+
 type HistoryEntry struct {
-	Entry   string `json:"entry"`
-	Created string `json:"created"`
+	Time      string            `json:"time"`
+	Operation string            `json:"operation"`
+	ItemType  string            `json:"item_type"`
+	ItemName  string            `json:"item_name"`
+	Params    map[string]string `json:"params,omitempty"`
+	Result    string            `json:"result"`
+	Error     string            `json:"error,omitempty"`
+	User      string            `json:"user"`
+
+	// Entry holds the free-text description of entries written before
+	// history was structured
+	Entry string `json:"entry,omitempty"`
+}
+
+func (he *HistoryEntry) GetTime() (time.Time, error) {
+	return time.Parse(time.RFC3339, he.Time)
+}
+
+func GetInvokingUser() string {
+	for _, e := range []string{"SUDO_USER", "DOAS_USER"} {
+		if os.Getenv(e) != "" {
+			return os.Getenv(e)
+		}
+	}
+	u, err := user.Current()
+	if err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "uid:" + strconv.Itoa(os.Getuid())
 }
 
-func NewHistoryEntry(c string, e string) *HistoryEntry {
-	he := &HistoryEntry{Entry: e, Created: c}
+func NewHistoryEntry(op string, t string, n string, p map[string]string, err error) *HistoryEntry {
+	he := &HistoryEntry{
+		Time:      time.Now().Format(time.RFC3339),
+		Operation: op,
+		ItemType:  t,
+		ItemName:  n,
+		Params:    p,
+		Result:    HISTORY_RESULT_OK,
+		User:      GetInvokingUser(),
+	}
+	if err != nil {
+		he.Result = HISTORY_RESULT_ERROR
+		he.Error = err.Error()
+	}
 	return he
 }
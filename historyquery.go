@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type HistoryQuery struct {
+	ItemType  string
+	ItemName  string
+	Operation string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+func ParseHistoryTime(s string) (time.Time, error) {
+	for _, l := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.ParseInLocation(l, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("Invalid time '%s'. Use RFC3339 or YYYY-MM-DD format", s))
+}
+
+// ParseHistoryUntil parses s like ParseHistoryTime but a date without time
+// covers the whole day, so the returned time is the end of that day
+func ParseHistoryUntil(s string) (time.Time, error) {
+	t, err := ParseHistoryTime(s)
+	if err != nil {
+		return t, err
+	}
+	_, err = time.ParseInLocation("2006-01-02", s, time.Local)
+	if err == nil {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+func (hq *HistoryQuery) Match(he *HistoryEntry) bool {
+	if hq.ItemType != "" && he.ItemType != hq.ItemType {
+		return false
+	}
+	if hq.ItemName != "" && he.ItemName != hq.ItemName {
+		return false
+	}
+	if hq.Operation != "" && he.Operation != hq.Operation {
+		return false
+	}
+	if !hq.Since.IsZero() || !hq.Until.IsZero() {
+		t, err := he.GetTime()
+		if err != nil {
+			return false
+		}
+		if !hq.Since.IsZero() && t.Before(hq.Since) {
+			return false
+		}
+		if !hq.Until.IsZero() && t.After(hq.Until) {
+			return false
+		}
+	}
+	return true
+}
+
+// Run returns matching entries sorted by time. When limit is set then only
+// the most recent entries are returned.
+func (hq *HistoryQuery) Run(hs []*HistoryEntry) []*HistoryEntry {
+	l := []*HistoryEntry{}
+	for _, he := range hs {
+		if he != nil && hq.Match(he) {
+			l = append(l, he)
+		}
+	}
+	sort.SliceStable(l, func(i, k int) bool {
+		ti, err1 := l[i].GetTime()
+		tk, err2 := l[k].GetTime()
+		if err1 != nil || err2 != nil {
+			return l[i].Time < l[k].Time
+		}
+		return ti.Before(tk)
+	})
+	if hq.Limit > 0 && len(l) > hq.Limit {
+		l = l[len(l)-hq.Limit:]
+	}
+	return l
+}
+
+func PrintHistoryEntries(f *os.File, hs []*HistoryEntry, asJSON bool) error {
+	if asJSON {
+		o, err := json.MarshalIndent(hs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f, "%s\n", o)
+		return nil
+	}
+
+	for _, he := range hs {
+		n := he.ItemName
+		if n == "" {
+			n = "-"
+		}
+		u := he.User
+		if u == "" {
+			u = "-"
+		}
+		s := fmt.Sprintf("%s %s %s %s %s %s", he.Time, u, he.Operation, he.ItemType, n, he.Result)
+
+		ks := []string{}
+		for k := range he.Params {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			s += fmt.Sprintf(" %s=%s", k, he.Params[k])
+		}
+		if he.Error != "" {
+			s += fmt.Sprintf(" error=%q", he.Error)
+		}
+		if he.Entry != "" {
+			s += fmt.Sprintf(" %q", he.Entry)
+		}
+		fmt.Fprintf(f, "%s\n", strings.TrimSpace(s))
+	}
+	return nil
+}
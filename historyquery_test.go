@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestHistoryEntry(s string) *HistoryEntry {
+	t, _ := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	return &HistoryEntry{Time: t.Format(time.RFC3339)}
+}
+
+func TestHistoryQueryUntilDateCoversWholeDay(t *testing.T) {
+	hq := &HistoryQuery{}
+	var err error
+	hq.Until, err = ParseHistoryUntil("2024-05-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		time  string
+		match bool
+	}{
+		{"2024-05-01 00:00:00", true},
+		{"2024-05-01 23:59:59", true},
+		{"2024-05-02 00:00:00", false},
+	} {
+		if hq.Match(newTestHistoryEntry(c.time)) != c.match {
+			t.Errorf("Match returned %v for entry at %s", !c.match, c.time)
+		}
+	}
+
+	hq.Until, err = ParseHistoryUntil("2024-05-01 12:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hq.Match(newTestHistoryEntry("2024-05-01 12:00:01")) {
+		t.Errorf("Match returned true for entry after time given with --until")
+	}
+}
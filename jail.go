@@ -8,8 +8,15 @@ import (
 	"regexp"
 )
 
+const JAIL_MODE_THICK = "thick"
+const JAIL_MODE_THIN = "thin"
+
 type Jail struct {
 	Release     string            `json:"release"`
+	Sets        []string          `json:"sets"`
+	BaseSHA256  string            `json:"base_sha256"`
+	Mode        string            `json:"mode"`
+	Template    string            `json:"template"`
 	SourceURL   string            `json:"source_url"`
 	Name        string            `json:"name"`
 	Created     string            `json:"created"`
@@ -28,8 +35,26 @@ func (jl *Jail) SetLogger(f func(int, string)) {
 	jl.logger = f
 }
 
-func (jl *Jail) AddHistoryEntry(s string) {
-	he := NewHistoryEntry(GetCurrentDateTime(), s)
+// GetMode returns whether jail has its own copy of base or shares it, jails
+// created before thin jails were introduced are thick
+func (jl *Jail) GetMode() string {
+	if jl.Mode == "" {
+		return JAIL_MODE_THICK
+	}
+	return jl.Mode
+}
+
+// IsBaseUnknown tells whether jail has been created from a base which has not
+// been recorded. Jails with 'path' from the file do not use any base.
+func (jl *Jail) IsBaseUnknown() bool {
+	if jl.Release != "" || jl.Dir == nil || jl.Config == nil {
+		return false
+	}
+	return jl.Config.Config["path"] == jl.Dir.Dirpath || jl.Config.Config["path"] == jl.Dir.GetThinRootPath()
+}
+
+func (jl *Jail) AddHistoryEntry(op string, p map[string]string, err error) {
+	he := NewHistoryEntry(op, "jail", jl.Name, p, err)
 	if jl.History == nil {
 		jl.History = []*HistoryEntry{}
 	}
@@ -60,12 +85,13 @@ func (jl *Jail) Start() error {
 	err := CmdRun(jl.logger, "jail", "-c", "-f", jl.Config.Filepath)
 	if err != nil {
 		jl.State = "error_starting"
+		jl.AddHistoryEntry("start", nil, err)
 		return errors.New(fmt.Sprintf("Error executing 'jail' command: %s", err.Error()))
 	}
 	jl.State = "started"
 
 	jl.Iteration++
-	jl.AddHistoryEntry("Start")
+	jl.AddHistoryEntry("start", nil, nil)
 
 	return nil
 }
@@ -75,12 +101,13 @@ func (jl *Jail) Stop() error {
 	err := CmdRun(jl.logger, "jail", "-r", jl.Name)
 	if err != nil {
 		jl.State = "error_stopping"
+		jl.AddHistoryEntry("stop", nil, err)
 		return errors.New(fmt.Sprintf("Error executing 'jail' command: %s", err.Error()))
 	}
 	jl.State = "stopped"
 
 	jl.Iteration++
-	jl.AddHistoryEntry("Stop")
+	jl.AddHistoryEntry("stop", nil, nil)
 
 	return nil
 }
@@ -96,11 +123,6 @@ func (jl *Jail) Remove() error {
 	return nil
 }
 
-func (jl *Jail) CleanAfterError() error {
-	_ = jl.Remove()
-	return nil
-}
-
 func (jl *Jail) Import() error {
 	_, _, err := StatWithLog(jl.Dir.Dirpath, jl.logger)
 	if err != nil {
@@ -129,6 +151,7 @@ func (jl *Jail) Import() error {
 	}
 
 	jl.logger(LOGDBG, "Jail source directory and config exist and jail can be imported")
+	jl.AddHistoryEntry("import", map[string]string{"state": jl.State}, nil)
 	return nil
 }
 
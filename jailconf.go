@@ -16,6 +16,9 @@ const CHAR_BEGIN_VAL = "="
 const CHAR_BEGIN_BLK = "{"
 const CHAR_END_BLK = "}"
 
+// Keys with this prefix are read by jailguard and not written to jail.conf
+const JAILCONF_JAILGUARD_PREFIX = "jailguard."
+
 type JailConf struct {
 	Name      string            `json:"name"`
 	Config    map[string]string `json:"config"`
@@ -35,8 +38,8 @@ func (jc *JailConf) SetLogger(f func(int, string)) {
 	jc.logger = f
 }
 
-func (jc *JailConf) AddHistoryEntry(s string) {
-	he := NewHistoryEntry(GetCurrentDateTime(), s)
+func (jc *JailConf) AddHistoryEntry(op string, p map[string]string, err error) {
+	he := NewHistoryEntry(op, "jailconf", jc.Name, p, err)
 	if jc.History == nil {
 		jc.History = []*HistoryEntry{}
 	}
@@ -113,7 +116,7 @@ func (jc *JailConf) Validate() error {
 	keys := []string{"allow.raw_sockets", "mount.devfs"}
 	for _, k := range keys {
 		if jc.Config[k] != "" {
-			if jc.Config[k] != "true" || jc.Config[k] != "false" {
+			if jc.Config[k] != "true" && jc.Config[k] != "false" {
 				return errors.New(fmt.Sprintf("%s should be 'true' or 'false'", k))
 			}
 		}
@@ -149,6 +152,9 @@ func (jc *JailConf) Write(p string) error {
 	jc.Iteration++
 	o := jc.Name + " {\n"
 	for k, v := range jc.Config {
+		if strings.HasPrefix(k, JAILCONF_JAILGUARD_PREFIX) {
+			continue
+		}
 		if v == "true" {
 			o = o + fmt.Sprintf("  %s;\n", k)
 		} else {
@@ -164,9 +170,11 @@ func (jc *JailConf) Write(p string) error {
 	jc.logger(LOGDBG, fmt.Sprintf("Writing jail config..."))
 	err = ioutil.WriteFile(jc.Filepath, []byte(o), 0644)
 	if err != nil {
+		jc.AddHistoryEntry("write", map[string]string{"path": jc.Filepath}, err)
 		return err
 	}
 	jc.logger(LOGDBG, "Config has been written to a file")
+	jc.AddHistoryEntry("write", map[string]string{"path": jc.Filepath}, nil)
 
 	return nil
 }
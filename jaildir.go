@@ -3,14 +3,24 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+// Directories of a thin jail that are writable, the rest comes from the base
+var jailDirThinSkeleton = []string{"etc", "var", "usr/local", "root", "tmp"}
+
 type JailDir struct {
 	Name        string `json:"name"`
 	Created     string `json:"created"`
 	LastUpdated string `json:"last_updated"`
 	Dirpath     string `json:"dirpath"`
+	Dataset     string `json:"dataset"`
+	Origin      string `json:"origin"`
+
+	Snapshots []*JailSnapshot `json:"snapshots"`
 
 	Iteration int             `json:"iteration"`
 	History   []*HistoryEntry `json:"history"`
@@ -26,15 +36,58 @@ func (jd *JailDir) SetDefaultValues() {
 	jd.Iteration = 1
 }
 
-func (jd *JailDir) AddHistoryEntry(s string) {
-	he := NewHistoryEntry(GetCurrentDateTime(), s)
+func (jd *JailDir) AddHistoryEntry(op string, p map[string]string, err error) {
+	he := NewHistoryEntry(op, "jaildir", jd.Name, p, err)
 	if jd.History == nil {
 		jd.History = []*HistoryEntry{}
 	}
 	jd.History = append(jd.History, he)
 }
 
+func (jd *JailDir) GetThinRootPath() string {
+	return jd.Dirpath + "/root"
+}
+
+func (jd *JailDir) getThinSkeletonPath() string {
+	return jd.Dirpath + "/skeleton"
+}
+
+func (jd *JailDir) GetFstabPath() string {
+	return jd.Dirpath + "/fstab"
+}
+
+func (jd *JailDir) getZFS() *ZFS {
+	z := NewZFS()
+	z.SetLogger(jd.logger)
+	return z
+}
+
+// createDir creates jail directory as a dataset when Dataset is set
+func (jd *JailDir) createDir() error {
+	if jd.Dataset != "" {
+		return jd.getZFS().Create(jd.Dataset)
+	}
+	return CreateDirWithLog(jd.Dirpath, jd.logger)
+}
+
 func (jd *JailDir) Remove() error {
+	if jd.Dataset != "" && jd.getZFS().Exists(jd.Dataset) {
+		_ = CmdRun(jd.logger, "chflags", "-R", "noschg", jd.Dirpath)
+		err := jd.getZFS().Destroy(jd.Dataset)
+		if err != nil {
+			return errors.New("Error has occurred while removing jail dataset. Please destroy it manually and remove the state")
+		}
+	}
+
+	for _, sn := range jd.Snapshots {
+		if sn.Filepath != "" {
+			err := RemoveAllWithLog(sn.Filepath, jd.logger)
+			if err != nil {
+				return errors.New("Error has occurred while removing jail snapshots. Please remove them manually and remove the state")
+			}
+		}
+	}
+
 	_, _, err := StatWithLog(jd.Dirpath, jd.logger)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -45,6 +98,8 @@ func (jd *JailDir) Remove() error {
 		}
 	}
 
+	jd.unmountThin()
+
 	err1 := CmdRun(jd.logger, "chflags", "-R", "noschg", jd.Dirpath)
 	err2 := RemoveAllWithLog(jd.Dirpath, jd.logger)
 	if err1 != nil || err2 != nil {
@@ -54,7 +109,187 @@ func (jd *JailDir) Remove() error {
 	return nil
 }
 
-func (jd *JailDir) CreateFromTarball(t string) error {
+// unmountThin unmounts shared base of a thin jail so it is not modified
+// through its mount
+func (jd *JailDir) unmountThin() {
+	_, _, err := StatWithLog(jd.GetFstabPath(), jd.logger)
+	if err == nil {
+		_ = CmdRun(jd.logger, "umount", "-a", "-F", jd.GetFstabPath())
+	}
+}
+
+func (jd *JailDir) GetSnapshot(id string) *JailSnapshot {
+	for _, sn := range jd.Snapshots {
+		if sn.ID == id {
+			return sn
+		}
+	}
+	return nil
+}
+
+// getJailSnapshotExcludes returns paths that are not archived in a snapshot
+// of jail in mode. Root of a thin jail is the mounted base and devfs is
+// mounted in a thick one.
+func getJailSnapshotExcludes(mode string) []string {
+	if mode == JAIL_MODE_THIN {
+		return []string{"./root/*"}
+	}
+	return []string{"./dev/*"}
+}
+
+// TakeSnapshot takes ZFS snapshot of jail dataset or archives jail directory
+// into a tarball in directory d. Filesystems mounted in the jail of mode are
+// skipped.
+func (jd *JailDir) TakeSnapshot(sn *JailSnapshot, d string, mode string) error {
+	p := map[string]string{"snapshot": sn.ID}
+	var err error
+	if jd.Dataset != "" {
+		sn.Type = JAILSNAPSHOT_TYPE_ZFS
+		sn.Snapshot = jd.Dataset + "@" + sn.ID
+		p["dataset"] = sn.Snapshot
+		err = jd.getZFS().Snapshot(sn.Snapshot)
+	} else {
+		sn.Type = JAILSNAPSHOT_TYPE_TAR
+		sn.Filepath = d + "/" + sn.ID + ".tgz"
+		p["tarball"] = sn.Filepath
+		err = CreateDirWithLog(d, jd.logger)
+		if err == nil {
+			err = CmdTarCreateWithLog(sn.Filepath, jd.Dirpath, getJailSnapshotExcludes(mode), jd.logger)
+			if err != nil {
+				_ = RemoveAllWithLog(sn.Filepath, jd.logger)
+			}
+		}
+	}
+	if err != nil {
+		jd.AddHistoryEntry("snapshot", p, err)
+		return errors.New(fmt.Sprintf("Error has occurred when taking snapshot %s: %s", sn.ID, err.Error()))
+	}
+
+	jd.Snapshots = append(jd.Snapshots, sn)
+	jd.AddHistoryEntry("snapshot", p, nil)
+	return nil
+}
+
+// Rollback brings jail directory back to snapshot id. ZFS cannot keep
+// snapshots newer than the one rolled back to so they are destroyed and
+// removed from the list.
+func (jd *JailDir) Rollback(id string) error {
+	sn := jd.GetSnapshot(id)
+	if sn == nil {
+		return errors.New(fmt.Sprintf("Snapshot %s does not exist", id))
+	}
+
+	p := map[string]string{"snapshot": id}
+	var err error
+	if sn.Type == JAILSNAPSHOT_TYPE_ZFS {
+		jd.unmountThin()
+		err = jd.getZFS().Rollback(sn.Snapshot)
+		if err == nil {
+			l := []*JailSnapshot{}
+			newer := false
+			for _, sn2 := range jd.Snapshots {
+				if newer && sn2.Type == JAILSNAPSHOT_TYPE_ZFS {
+					jd.logger(LOGINF, fmt.Sprintf("Snapshot %s has been destroyed by the rollback", sn2.ID))
+					continue
+				}
+				if sn2 == sn {
+					newer = true
+				}
+				l = append(l, sn2)
+			}
+			jd.Snapshots = l
+		}
+	} else {
+		err = jd.rollbackTar(sn)
+	}
+	if err != nil {
+		jd.AddHistoryEntry("rollback", p, err)
+		return errors.New(fmt.Sprintf("Error has occurred when rolling back to snapshot %s: %s", id, err.Error()))
+	}
+
+	jd.AddHistoryEntry("rollback", p, nil)
+	return nil
+}
+
+// rollbackTar extracts tarball snapshot next to the jail directory and swaps
+// the directories only when the extraction succeeds
+func (jd *JailDir) rollbackTar(sn *JailSnapshot) error {
+	_, _, err := StatWithLog(sn.Filepath, jd.logger)
+	if err != nil {
+		return err
+	}
+
+	tmp := jd.Dirpath + ".rollback"
+	old := jd.Dirpath + ".old"
+	jd.removeDirWithFlags(tmp)
+	err = CreateDirWithLog(tmp, jd.logger)
+	if err == nil {
+		err = CmdTarExtractWithLog(sn.Filepath, tmp, jd.logger)
+	}
+	if err != nil {
+		jd.removeDirWithFlags(tmp)
+		return err
+	}
+
+	jd.unmountThin()
+	jd.removeDirWithFlags(old)
+	err = os.Rename(jd.Dirpath, old)
+	if err != nil {
+		jd.removeDirWithFlags(tmp)
+		return err
+	}
+	err = os.Rename(tmp, jd.Dirpath)
+	if err != nil {
+		_ = os.Rename(old, jd.Dirpath)
+		jd.removeDirWithFlags(tmp)
+		return err
+	}
+	jd.removeDirWithFlags(old)
+	return nil
+}
+
+func (jd *JailDir) removeDirWithFlags(p string) {
+	_, _, err := StatWithLog(p, jd.logger)
+	if err != nil {
+		return
+	}
+	_ = CmdRun(jd.logger, "chflags", "-R", "noschg", p)
+	_ = RemoveAllWithLog(p, jd.logger)
+}
+
+func (jd *JailDir) RemoveSnapshot(id string) error {
+	sn := jd.GetSnapshot(id)
+	if sn == nil {
+		return errors.New(fmt.Sprintf("Snapshot %s does not exist", id))
+	}
+
+	p := map[string]string{"snapshot": id}
+	var err error
+	if sn.Type == JAILSNAPSHOT_TYPE_ZFS {
+		if jd.getZFS().Exists(sn.Snapshot) {
+			err = jd.getZFS().Destroy(sn.Snapshot)
+		}
+	} else {
+		err = RemoveAllWithLog(sn.Filepath, jd.logger)
+	}
+	if err != nil {
+		jd.AddHistoryEntry("snapshot_remove", p, err)
+		return errors.New(fmt.Sprintf("Error has occurred when removing snapshot %s: %s", id, err.Error()))
+	}
+
+	l := []*JailSnapshot{}
+	for _, sn2 := range jd.Snapshots {
+		if sn2.ID != id {
+			l = append(l, sn2)
+		}
+	}
+	jd.Snapshots = l
+	jd.AddHistoryEntry("snapshot_remove", p, nil)
+	return nil
+}
+
+// CreateFromTarballs extracts tarballs into the jail directory in order
+func (jd *JailDir) CreateFromTarballs(ts []string) error {
 	_, _, err := StatWithLog(jd.Dirpath, jd.logger)
 	if err != nil && !os.IsNotExist(err) {
 		return errors.New("Error has occurred when creating jail directory")
@@ -63,18 +298,122 @@ func (jd *JailDir) CreateFromTarball(t string) error {
 		return errors.New("Jail directory already exists")
 	}
 
-	err = CreateDirWithLog(jd.Dirpath, jd.logger)
+	err = jd.createDir()
 	if err != nil {
 		return err
 	}
 
-	err = CmdTarExtractWithLog(t, jd.Dirpath, jd.logger)
-	if err != nil {
-		return errors.New("Error has occurred when extracting tarball")
+	p := map[string]string{"path": jd.Dirpath, "tarball": strings.Join(ts, ",")}
+	if jd.Dataset != "" {
+		p["dataset"] = jd.Dataset
+	}
+	for _, t := range ts {
+		err = CmdTarExtractWithLog(t, jd.Dirpath, jd.logger)
+		if err != nil {
+			jd.AddHistoryEntry("create", p, err)
+			return errors.New(fmt.Sprintf("Error has occurred when extracting tarball %s", t))
+		}
 	}
 	jd.logger(LOGDBG, fmt.Sprintf("Jail source directory %s has been successfully created", jd.Dirpath))
 
-	jd.AddHistoryEntry(fmt.Sprintf("Create jail source directory %s", jd.Dirpath))
+	jd.AddHistoryEntry("create", p, nil)
+
+	return nil
+}
+
+// CreateThin creates directory of a thin jail where base root r is mounted
+// read-only and writable skeleton copied from r is mounted on top of it.
+// Mounts are listed in fstab file for mount.fstab.
+func (jd *JailDir) CreateThin(r string) error {
+	_, _, err := StatWithLog(jd.Dirpath, jd.logger)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("Error has occurred when creating jail directory")
+	}
+	if err == nil {
+		return errors.New("Jail directory already exists")
+	}
+
+	p := map[string]string{"path": jd.Dirpath, "base_root": r}
+	if jd.Dataset != "" {
+		p["dataset"] = jd.Dataset
+	}
+	err = jd.createDir()
+	if err != nil {
+		jd.AddHistoryEntry("create_thin", p, err)
+		return err
+	}
+	root := jd.GetThinRootPath()
+	skel := jd.getThinSkeletonPath()
+	for _, d := range []string{root, skel} {
+		err = CreateDirWithLog(d, jd.logger)
+		if err != nil {
+			jd.AddHistoryEntry("create_thin", p, err)
+			return err
+		}
+	}
+
+	fstab := fmt.Sprintf("%s %s nullfs ro 0 0\n", r, root)
+	for _, d := range jailDirThinSkeleton {
+		src := r + "/" + d
+		dst := skel + "/" + d
+		_, _, err = StatWithLog(src, jd.logger)
+		if err != nil && !os.IsNotExist(err) {
+			jd.AddHistoryEntry("create_thin", p, err)
+			return err
+		}
+		if err == nil {
+			err = CreateDirWithLog(filepath.Dir(dst), jd.logger)
+			if err == nil {
+				err = CmdRun(jd.logger, "cp", "-Rp", src, dst)
+			}
+		} else {
+			// Mount point has to exist in the base
+			err = CreateDirWithLog(src, jd.logger)
+			if err == nil {
+				err = CreateDirWithLog(dst, jd.logger)
+			}
+		}
+		if err != nil {
+			jd.AddHistoryEntry("create_thin", p, err)
+			return errors.New(fmt.Sprintf("Error has occurred when creating %s in jail skeleton", d))
+		}
+		fstab += fmt.Sprintf("%s %s nullfs rw 0 0\n", dst, root+"/"+d)
+	}
+
+	err = ioutil.WriteFile(jd.GetFstabPath(), []byte(fstab), 0644)
+	if err != nil {
+		jd.AddHistoryEntry("create_thin", p, err)
+		return err
+	}
+	jd.logger(LOGDBG, fmt.Sprintf("Thin jail directory %s has been successfully created", jd.Dirpath))
+
+	jd.AddHistoryEntry("create_thin", p, nil)
+
+	return nil
+}
+
+// CreateFromSnapshot creates jail dataset as a clone of base snapshot
+func (jd *JailDir) CreateFromSnapshot(snap string) error {
+	if jd.Dataset == "" {
+		return errors.New("Jail directory is not a dataset")
+	}
+	_, _, err := StatWithLog(jd.Dirpath, jd.logger)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("Error has occurred when creating jail directory")
+	}
+	if err == nil {
+		return errors.New("Jail directory already exists")
+	}
+
+	p := map[string]string{"path": jd.Dirpath, "dataset": jd.Dataset, "snapshot": snap}
+	err = jd.getZFS().Clone(snap, jd.Dataset)
+	if err != nil {
+		jd.AddHistoryEntry("create_clone", p, err)
+		return err
+	}
+	jd.logger(LOGDBG, fmt.Sprintf("Jail dataset %s has been successfully cloned from %s", jd.Dataset, snap))
+
+	jd.AddHistoryEntry("create_clone", p, nil)
 
 	return nil
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJailDirTakeSnapshotExcludes(t *testing.T) {
+	d, err := ioutil.TempDir("", "jailguard-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tc := newTestCmds()
+	defer tc.install()()
+
+	jd := NewJailDir("t1", d+"/jails/t1")
+	jd.SetLogger(func(int, string) {})
+	for _, c := range []struct {
+		mode string
+		excl string
+	}{
+		{JAIL_MODE_THICK, "./dev/*"},
+		{JAIL_MODE_THIN, "./root/*"},
+	} {
+		tc.Run = []string{}
+		sn := NewJailSnapshot(c.mode, "")
+		err = jd.TakeSnapshot(sn, d+"/snapshots", c.mode)
+		if err != nil {
+			t.Fatalf("TakeSnapshot returned error: %s", err.Error())
+		}
+		checkTestCmdsRun(t, tc, []string{"tar -c -p -z -f " + d + "/snapshots/" + c.mode + ".tgz --exclude " + c.excl + " -C " + d + "/jails/t1 ."})
+	}
+}
+
+func TestJailDirRollbackTar(t *testing.T) {
+	d, err := ioutil.TempDir("", "jailguard-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tc := newTestCmds()
+	defer tc.install()()
+
+	jd := NewJailDir("t1", d+"/jails/t1")
+	jd.SetLogger(func(int, string) {})
+	err = os.MkdirAll(jd.Dirpath, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(jd.Dirpath+"/current", []byte{}, 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(d+"/sn1.tgz", []byte{}, 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sn := NewJailSnapshot("sn1", "")
+	sn.Type = JAILSNAPSHOT_TYPE_TAR
+	sn.Filepath = d + "/sn1.tgz"
+	jd.Snapshots = []*JailSnapshot{sn}
+
+	tc.Handlers["tar"] = func(a []string) ([]byte, error) {
+		return []byte{}, errors.New("Corrupted archive")
+	}
+	err = jd.Rollback("sn1")
+	if err == nil {
+		t.Fatalf("Rollback did not return error when extraction failed")
+	}
+	_, err = os.Stat(jd.Dirpath + "/current")
+	if err != nil {
+		t.Errorf("Jail directory has been modified by failed rollback")
+	}
+	_, err = os.Stat(jd.Dirpath + ".rollback")
+	if !os.IsNotExist(err) {
+		t.Errorf("Temporary directory has not been removed")
+	}
+
+	tc.Handlers["tar"] = func(a []string) ([]byte, error) {
+		return []byte{}, ioutil.WriteFile(a[len(a)-1]+"/restored", []byte{}, 0644)
+	}
+	err = jd.Rollback("sn1")
+	if err != nil {
+		t.Fatalf("Rollback returned error: %s", err.Error())
+	}
+	_, err = os.Stat(jd.Dirpath + "/restored")
+	if err != nil {
+		t.Errorf("Snapshot has not been extracted to jail directory")
+	}
+	_, err = os.Stat(jd.Dirpath + "/current")
+	if !os.IsNotExist(err) {
+		t.Errorf("Old jail directory contents have not been replaced")
+	}
+	_, err = os.Stat(jd.Dirpath + ".old")
+	if !os.IsNotExist(err) {
+		t.Errorf("Old jail directory has not been removed")
+	}
+
+	os.Remove(sn.Filepath)
+	err = jd.Rollback("sn1")
+	if err == nil {
+		t.Errorf("Rollback did not return error when snapshot file is missing")
+	}
+}
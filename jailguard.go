@@ -2,10 +2,12 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/nicholasgasior/go-cli"
 	"log"
 	"os"
+	"strings"
 )
 
 const DIRCONFIG = "/usr/local/etc/jailguard.conf.json"
@@ -15,12 +17,16 @@ const LOGERR = -1
 const LOGDBG = 2
 
 type Jailguard struct {
-	cli    *cli.CLI
-	config *Config
-	logBuf bytes.Buffer
-	logger *log.Logger
-	Quiet  bool
-	Debug  bool
+	cli     *cli.CLI
+	config  *Config
+	state   *State
+	lock    *FileLock
+	journal *Journal
+	profile string
+	logBuf  bytes.Buffer
+	logger  *log.Logger
+	Quiet   bool
+	Debug   bool
 }
 
 func (j *Jailguard) GetCLI() *cli.CLI {
@@ -39,21 +45,89 @@ func (j *Jailguard) initLogger() {
 	j.logger = log.New(&(j.logBuf), "", 0)
 }
 
+// parseGlobalFlags removes --config and --profile flags from args as they
+// apply to all the commands
+func parseGlobalFlags(args []string) ([]string, string, string, error) {
+	l := []string{}
+	vs := map[string]string{"config": "", "profile": ""}
+	for i := 0; i < len(args); i++ {
+		found := false
+		for k := range vs {
+			if args[i] == "--"+k {
+				if i+1 >= len(args) {
+					return nil, "", "", errors.New(fmt.Sprintf("Flag --%s requires a value", k))
+				}
+				vs[k] = args[i+1]
+				i++
+				found = true
+			} else if strings.HasPrefix(args[i], "--"+k+"=") {
+				vs[k] = strings.TrimPrefix(args[i], "--"+k+"=")
+				found = true
+			}
+		}
+		if !found {
+			l = append(l, args[i])
+		}
+	}
+	return l, vs["config"], vs["profile"], nil
+}
+
 func (j *Jailguard) Run() {
+	args, f, p, err := parseGlobalFlags(os.Args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+	os.Args = args
+	fromFlag := f != ""
+	if !fromFlag {
+		f = DIRCONFIG
+	}
+
 	j.initLogger()
 	c := NewJailguardCLI(j)
 	j.cli = c
-	cfg, err := NewConfig(DIRCONFIG)
+	cfg, err := NewConfig(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
 	cfg.SetLogger(func(t int, s string) {
 		j.Log(t, s)
 	})
+	j.config = cfg
+	if fromFlag {
+		cfg.SetFileFromFlag()
+	}
+
+	v, bak := cfg.GetMigratedFrom()
+	if v > 0 {
+		fmt.Fprintf(os.Stderr, "Config file %s has been migrated from version %d to %d. Previous file has been saved as %s\n", f, v, CONFIG_VERSION, bak)
+	}
+
+	if p != "" {
+		err = cfg.ApplyProfile(p)
+	}
+	if err == nil {
+		err = cfg.ApplyEnv()
+	}
 	if err != nil {
-		fmt.Fprintf(j.cli.GetStderr(), err.Error())
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
 	}
-	j.config = cfg
-	// TODO: Validate config
-	os.Exit(c.Run(os.Stdout, os.Stderr))
+	j.profile = p
+
+	err = cfg.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config is invalid: %s\n", err.Error())
+		// Config commands still have to work so that the value can be fixed
+		if len(os.Args) < 2 || !strings.HasPrefix(os.Args[1], "config_") {
+			os.Exit(1)
+		}
+	}
+	code := c.Run(os.Stdout, os.Stderr)
+	j.releaseState()
+	os.Exit(code)
 }
 
 func (j *Jailguard) Log(t int, s string) {
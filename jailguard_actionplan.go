@@ -0,0 +1,18 @@
+package main
+
+func (j *Jailguard) applyActionPlan(st *State, ap *ActionPlan, q string, yes bool, op string, params map[string]string) error {
+	if !yes && !j.confirm(q) {
+		j.Log(LOGINF, "Aborted")
+		return nil
+	}
+
+	errApply := ap.Apply()
+
+	st.AddHistoryEntry(op, "state", "", params, errApply)
+	err := st.Save()
+	if err != nil {
+		return err
+	}
+
+	return errApply
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 )
 
 func (j *Jailguard) getBaseDirPath(rls string) string {
 	c := j.GetConfig()
-	return c.PathData + "/" + c.DirBases + "/" + rls
+	return c.GetDirPath(c.DirBases) + "/" + rls
 }
 
 func (j *Jailguard) getNewBase(rls string) *Base {
@@ -14,10 +18,68 @@ func (j *Jailguard) getNewBase(rls string) *Base {
 	bs.SetLogger(func(t int, s string) {
 		j.Log(t, s)
 	})
+	bs.SetMirrors(j.GetConfig().GetMirrors())
+	bs.SetDownloader(j.getNewDownloader())
 	return bs
 }
 
-func (j *Jailguard) DownloadBase(rls string, ow bool) error {
+func (j *Jailguard) getNewDownloader() *Downloader {
+	dl := NewDownloader()
+	dl.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	dl.SetProgress(j.cli.GetStdout(), j.Quiet)
+	return dl
+}
+
+func (j *Jailguard) getOSArch() string {
+	out, err := CmdOut(j.Log, "uname", "-m")
+	if err != nil || !IsValidBaseArch(strings.TrimSpace(string(out))) {
+		j.Log(LOGDBG, fmt.Sprintf("Cannot get supported architecture of the system, using %s", BASE_DEFAULT_ARCH))
+		return BASE_DEFAULT_ARCH
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// getThinJailsOfBase returns names of thin jails that mount root of base rls
+func (j *Jailguard) getThinJailsOfBase(st *State, rls string) []string {
+	l := []string{}
+	for n, jl := range st.Jails {
+		if jl != nil && jl.Release == rls && jl.GetMode() == JAIL_MODE_THIN {
+			l = append(l, n)
+		}
+	}
+	sort.Strings(l)
+	return l
+}
+
+// checkBaseNotShared returns error when thin jails mount root of base rls or
+// jails are cloned from its snapshot so it cannot be replaced
+func (j *Jailguard) checkBaseNotShared(st *State, rls string) error {
+	l := []string{}
+	for n, jl := range st.Jails {
+		if jl == nil || jl.Release != rls {
+			continue
+		}
+		if jl.GetMode() == JAIL_MODE_THIN || (jl.Dir != nil && jl.Dir.Origin != "") {
+			l = append(l, n)
+		}
+	}
+	if len(l) > 0 {
+		sort.Strings(l)
+		return errors.New(fmt.Sprintf("Base %s is shared by jails: %s. Remove them first", rls, strings.Join(l, ", ")))
+	}
+	return nil
+}
+
+func (j *Jailguard) DownloadBase(rls string, arch string, sets []string, ow bool) error {
+	if arch == "" {
+		arch = j.getOSArch()
+	}
+	if !IsValidBaseArch(arch) {
+		return errors.New(fmt.Sprintf("Architecture %s is not supported", arch))
+	}
+
 	st, err := j.getState()
 	if err != nil {
 		return err
@@ -29,6 +91,12 @@ func (j *Jailguard) DownloadBase(rls string, ow bool) error {
 	}
 	if bs == nil {
 		bs = j.getNewBase(rls)
+		bs.Arch = arch
+		bs.Sets = sets
+		bs.Dataset, err = j.getBaseDataset(rls)
+		if err != nil {
+			return err
+		}
 		err = bs.Download(ow)
 		if err != nil {
 			return err
@@ -38,13 +106,33 @@ func (j *Jailguard) DownloadBase(rls string, ow bool) error {
 		bs.SetLogger(func(t int, s string) {
 			j.Log(t, s)
 		})
+		bs.SetMirrors(j.GetConfig().GetMirrors())
+		bs.SetDownloader(j.getNewDownloader())
+
+		if !ow && bs.GetArch() != arch {
+			return errors.New(fmt.Sprintf("Base %s has been downloaded for %s architecture. Use 'overwrite' flag to download it for %s", rls, bs.GetArch(), arch))
+		}
 
 		if ow {
+			err = j.checkBaseNotShared(st, rls)
+			if err != nil {
+				return err
+			}
 			j.Log(LOGINF, fmt.Sprintf("Base %s already exists but downloading it again...", rls))
+			bs.Arch = arch
+			bs.Sets = sets
 			err = bs.Download(ow)
 			if err != nil {
 				return err
 			}
+		} else if len(bs.GetMissingSets(sets)) > 0 {
+			m := bs.GetMissingSets(sets)
+			j.Log(LOGINF, fmt.Sprintf("Base %s already exists, downloading missing sets: %s...", rls, strings.Join(m, ", ")))
+			err = bs.AddSets(m)
+			if err != nil {
+				_ = st.Save()
+				return err
+			}
 		} else {
 			j.Log(LOGINF, fmt.Sprintf("Base %s already exists. Use 'overwrite' flag to download it again", rls))
 			return nil
@@ -59,7 +147,202 @@ func (j *Jailguard) DownloadBase(rls string, ow bool) error {
 	return nil
 }
 
-func (j *Jailguard) RemoveBase(rls string) error {
+func (j *Jailguard) ImportBase(n string, srcs []string, arch string, ow bool) error {
+	if arch == "" {
+		arch = j.getOSArch()
+	}
+	if !IsValidBaseArch(arch) {
+		return errors.New(fmt.Sprintf("Architecture %s is not supported", arch))
+	}
+
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	bs, err := st.GetBase(n)
+	if err != nil {
+		return err
+	}
+	if bs != nil && !ow {
+		return errors.New(fmt.Sprintf("Base %s already exists. Use 'overwrite' flag to import it again", n))
+	}
+	if bs != nil {
+		err = j.checkBaseNotShared(st, n)
+		if err != nil {
+			return err
+		}
+	}
+	if bs == nil {
+		bs = j.getNewBase(n)
+		bs.Dataset, err = j.getBaseDataset(n)
+		if err != nil {
+			return err
+		}
+	} else {
+		bs.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+		bs.SetDownloader(j.getNewDownloader())
+	}
+	bs.Arch = arch
+
+	err = bs.ImportFiles(srcs, ow)
+	if err != nil {
+		return err
+	}
+	st.AddBase(n, bs)
+
+	err = st.Save()
+	if err != nil {
+		return err
+	}
+
+	j.Log(LOGINF, fmt.Sprintf("Base %s has been imported with sets: %s", n, strings.Join(bs.GetSets(), ", ")))
+	if bs.ManifestGenerated {
+		j.Log(LOGINF, fmt.Sprintf("MANIFEST has not been provided so base %s cannot be verified and jails can be created from it only with --insecure flag", n))
+	}
+	return nil
+}
+
+func (j *Jailguard) VerifyBase(rls string) error {
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	bs, err := st.GetBase(rls)
+	if err != nil {
+		return err
+	}
+	if bs == nil {
+		return errors.New(fmt.Sprintf("Base %s not found in state file", rls))
+	}
+	bs.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	bs.SetMirrors(j.GetConfig().GetMirrors())
+	bs.SetDownloader(j.getNewDownloader())
+
+	_, _, err = StatWithLog(bs.getManifestPath(), j.Log)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.New(fmt.Sprintf("Error has occurred while getting stat for %s", bs.getManifestPath()))
+		}
+		j.Log(LOGINF, fmt.Sprintf("MANIFEST of base %s is missing, downloading it...", rls))
+		err = bs.DownloadManifest()
+		if err != nil {
+			return err
+		}
+	}
+
+	errVerify := bs.Verify()
+
+	err = st.Save()
+	if err != nil {
+		return err
+	}
+	if errVerify != nil {
+		return errVerify
+	}
+	if bs.ManifestGenerated {
+		j.Log(LOGINF, fmt.Sprintf("Base %s matches checksums taken on import but it has been imported without MANIFEST so it remains unverified", rls))
+		return nil
+	}
+
+	j.Log(LOGINF, fmt.Sprintf("Base %s has been verified", rls))
+	return nil
+}
+
+func getJailsWithUnknownBase(st *State) []string {
+	l := []string{}
+	for k, jl := range st.Jails {
+		if jl != nil && jl.IsBaseUnknown() {
+			l = append(l, k)
+		}
+	}
+	sort.Strings(l)
+	return l
+}
+
+// PruneBases removes bases no jail uses. When keep is greater than 0 then
+// that many newest bases of each major version are kept, bases which names
+// are not releases form a group each.
+func (j *Jailguard) PruneBases(keep int, dry bool) error {
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	l := getJailsWithUnknownBase(st)
+	if len(l) > 0 {
+		return errors.New(fmt.Sprintf("Jails %s do not record the base they have been created from so bases cannot be pruned safely. Remove unused bases with base_remove", strings.Join(l, ", ")))
+	}
+
+	groups := map[string][]string{}
+	for rls := range st.Bases {
+		g, _, ok := ParseBaseRelease(rls)
+		if !ok {
+			g = rls
+		}
+		groups[g] = append(groups[g], rls)
+	}
+
+	sd := NewStateDeps(st)
+	l = []string{}
+	for _, rlss := range groups {
+		sort.Slice(rlss, func(i, k int) bool {
+			return IsBaseReleaseNewer(rlss[i], rlss[k])
+		})
+		for i, rls := range rlss {
+			if i < keep {
+				j.Log(LOGDBG, fmt.Sprintf("Keeping base %s as one of %d newest of its version", rls, keep))
+				continue
+			}
+			if len(sd.GetDependants("base", rls)) > 0 {
+				j.Log(LOGDBG, fmt.Sprintf("Keeping base %s as it is used by jails", rls))
+				continue
+			}
+			l = append(l, rls)
+		}
+	}
+	sort.Strings(l)
+
+	if len(l) == 0 {
+		j.Log(LOGINF, "There are no bases to prune")
+		return nil
+	}
+	if dry {
+		for _, rls := range l {
+			fmt.Fprintf(j.cli.GetStdout(), "base %s\n", rls)
+		}
+		return nil
+	}
+
+	for _, rls := range l {
+		bs := st.Bases[rls]
+		bs.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+		j.Log(LOGINF, fmt.Sprintf("Removing base %s...", rls))
+		err = bs.Remove()
+		if err != nil {
+			return err
+		}
+		st.DeleteItem("base", rls)
+
+		// State is saved after each removal so it matches the disk when
+		// a later one fails
+		err = st.Save()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *Jailguard) RemoveBase(rls string, cascade bool) error {
 	st, err := j.getState()
 	if err != nil {
 		return err
@@ -76,12 +359,21 @@ func (j *Jailguard) RemoveBase(rls string) error {
 		j.Log(t, s)
 	})
 
+	err = j.removeDependants(st, "base", rls, cascade)
+	if err != nil {
+		return err
+	}
+	l := getJailsWithUnknownBase(st)
+	if len(l) > 0 {
+		j.Log(LOGINF, fmt.Sprintf("Jails %s do not record the base they have been created from, base %s may be one of them", strings.Join(l, ", "), rls))
+	}
+
 	err = bs.Remove()
 	if err != nil {
 		return err
 	}
 
-	st.RemoveItem("base", rls)
+	st.DeleteItem("base", rls)
 
 	err = st.Save()
 	if err != nil {
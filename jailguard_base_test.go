@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDownloadBaseFromMirror(t *testing.T) {
+	m := newTestMirror()
+	defer m.Close()
+	addTestRelease(m, "14.1-RELEASE", "arm64", map[string]string{"base": "base set", "lib32": "lib32 set"})
+
+	j, cleanup := newTestJailguard(t, m.URL())
+	defer cleanup()
+
+	err := j.DownloadBase("14.1-RELEASE", "arm64", []string{"base", "lib32"}, false)
+	if err != nil {
+		t.Fatalf("DownloadBase returned error: %s", err.Error())
+	}
+
+	for _, r := range m.Requests {
+		if !strings.HasPrefix(r, "/releases/arm64/aarch64/14.1-RELEASE/") {
+			t.Errorf("Unexpected request to %s", r)
+		}
+	}
+
+	st, _ := j.getState()
+	bs := st.Bases["14.1-RELEASE"]
+	if bs == nil {
+		t.Fatal("Base has not been added to the state")
+	}
+	if bs.Arch != "arm64" || !bs.Verified {
+		t.Errorf("Base has arch %s and verified %v, want arm64 and true", bs.Arch, bs.Verified)
+	}
+	b, err := ioutil.ReadFile(bs.GetSetTarballPath("lib32"))
+	if err != nil || string(b) != "lib32 set" {
+		t.Errorf("lib32 set has not been downloaded")
+	}
+}
+
+func TestDownloadBaseSkipsInvalidMirror(t *testing.T) {
+	bad := newTestMirror()
+	defer bad.Close()
+	addTestRelease(bad, "14.1-RELEASE", "amd64", map[string]string{"base": "base set"})
+	bad.Files[GetBaseURL("", "14.1-RELEASE", "amd64", "base.txz")] = []byte("tampered")
+
+	good := newTestMirror()
+	defer good.Close()
+	addTestRelease(good, "14.1-RELEASE", "amd64", map[string]string{"base": "base set"})
+
+	j, cleanup := newTestJailguard(t, bad.URL()+","+good.URL())
+	defer cleanup()
+
+	err := j.DownloadBase("14.1-RELEASE", "amd64", []string{"base"}, false)
+	if err != nil {
+		t.Fatalf("DownloadBase returned error: %s", err.Error())
+	}
+	st, _ := j.getState()
+	bs := st.Bases["14.1-RELEASE"]
+	if bs.SourceURL != GetBaseURL(good.URL(), "14.1-RELEASE", "amd64", "base.txz") {
+		t.Errorf("Base has been downloaded from %s", bs.SourceURL)
+	}
+	b, _ := ioutil.ReadFile(bs.GetBaseTarballPath())
+	if string(b) != "base set" {
+		t.Errorf("Base set has invalid contents: %s", string(b))
+	}
+}
+
+func TestDownloadBaseRefusesArchMismatch(t *testing.T) {
+	m := newTestMirror()
+	defer m.Close()
+	addTestRelease(m, "14.1-RELEASE", "amd64", map[string]string{"base": "amd64 base", "lib32": "amd64 lib32"})
+	addTestRelease(m, "14.1-RELEASE", "arm64", map[string]string{"base": "arm64 base", "lib32": "arm64 lib32"})
+
+	j, cleanup := newTestJailguard(t, m.URL())
+	defer cleanup()
+
+	err := j.DownloadBase("14.1-RELEASE", "amd64", []string{"base"}, false)
+	if err != nil {
+		t.Fatalf("DownloadBase returned error: %s", err.Error())
+	}
+
+	err = j.DownloadBase("14.1-RELEASE", "arm64", []string{"base", "lib32"}, false)
+	if err == nil {
+		t.Fatal("DownloadBase has not refused a different architecture")
+	}
+	st, _ := j.getState()
+	bs := st.Bases["14.1-RELEASE"]
+	if bs.Arch != "amd64" || len(bs.GetSets()) != 1 {
+		t.Errorf("Base has been changed to arch %s with sets %v", bs.Arch, bs.GetSets())
+	}
+
+	err = j.DownloadBase("14.1-RELEASE", "arm64", []string{"base", "lib32"}, true)
+	if err != nil {
+		t.Fatalf("DownloadBase with overwrite returned error: %s", err.Error())
+	}
+	bs = st.Bases["14.1-RELEASE"]
+	b, _ := ioutil.ReadFile(bs.GetBaseTarballPath())
+	if bs.Arch != "arm64" || string(b) != "arm64 base" {
+		t.Errorf("Base has arch %s and base set %s, want arm64", bs.Arch, string(b))
+	}
+}
+
+func TestImportBaseWithoutManifestIsNotVerified(t *testing.T) {
+	j, cleanup := newTestJailguard(t, "")
+	defer cleanup()
+
+	src := j.GetConfig().PathData + "/base.txz"
+	err := ioutil.WriteFile(src, []byte("base set"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.ImportBase("custom", []string{src}, "amd64", false)
+	if err != nil {
+		t.Fatalf("ImportBase returned error: %s", err.Error())
+	}
+	err = j.VerifyBase("custom")
+	if err != nil {
+		t.Fatalf("VerifyBase returned error: %s", err.Error())
+	}
+
+	st, _ := j.getState()
+	bs := st.Bases["custom"]
+	if !bs.ManifestGenerated || bs.Verified {
+		t.Errorf("Base has manifest generated %v and verified %v, want true and false", bs.ManifestGenerated, bs.Verified)
+	}
+}
+
+func TestImportBaseRejectsUnsupportedURL(t *testing.T) {
+	j, cleanup := newTestJailguard(t, "")
+	defer cleanup()
+
+	err := j.ImportBase("custom", []string{"ftp://ftp.freebsd.org/base.txz"}, "amd64", false)
+	if err == nil || !strings.Contains(err.Error(), "Only http and https") {
+		t.Errorf("ImportBase returned %v, want error about unsupported URL", err)
+	}
+}
@@ -1,20 +1,49 @@
 package main
 
+import (
+	"fmt"
+)
+
 func (j *Jailguard) ListConfig() error {
-	j.config.Print(j.cli.GetStdout(), "")
-	return nil
+	return j.config.Print(j.cli.GetStdout(), "", true)
 }
 
 func (j *Jailguard) SetConfigValue(k string, v string) error {
-	err := j.config.Set(k, v)
+	// Environment and profile values must not get into the file so it is
+	// read again
+	c, err := NewConfig(j.config.Filepath)
+	if err != nil {
+		return err
+	}
+	c.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+
+	if j.profile != "" {
+		err = c.SetInProfile(j.profile, k, v)
+	} else {
+		err = c.Set(k, v)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = c.Save()
 	if err != nil {
 		return err
 	}
-	err = j.config.Save()
-	return err
+
+	if j.config.GetSource(k) == CONFIGSRC_ENV {
+		j.Log(LOGINF, fmt.Sprintf("Value has been saved but it is overridden by %s environment variable", GetConfigEnvName(k)))
+	}
+	return nil
 }
 
 func (j *Jailguard) ShowConfigValue(k string) error {
-	j.config.Print(j.cli.GetStdout(), k)
+	return j.config.Print(j.cli.GetStdout(), k, false)
+}
+
+func (j *Jailguard) DescribeConfig() error {
+	PrintConfigKeys(j.cli.GetStdout())
 	return nil
 }
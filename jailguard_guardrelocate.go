@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// relocatePath returns p moved from directory o to n. Paths outside o are
+// returned as they are.
+func relocatePath(p string, o string, n string) string {
+	if p == o {
+		return n
+	}
+	if strings.HasPrefix(p, o+"/") {
+		return n + strings.TrimPrefix(p, o)
+	}
+	return p
+}
+
+// relocateFstab changes source and mount point paths in fstab file p from
+// directory o to n
+func (j *Jailguard) relocateFstab(p string, o string, n string) error {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	ls := strings.Split(string(b), "\n")
+	for i, l := range ls {
+		fs := strings.Fields(l)
+		if len(fs) < 2 || strings.HasPrefix(fs[0], "#") {
+			continue
+		}
+		fs[0] = relocatePath(fs[0], o, n)
+		fs[1] = relocatePath(fs[1], o, n)
+		ls[i] = strings.Join(fs, " ")
+	}
+	return WriteFileAtomicWithLog(p, []byte(strings.Join(ls, "\n")), 0644, j.Log)
+}
+
+func (j *Jailguard) moveDataDir(o string, n string) error {
+	err := CreateDirWithLog(filepath.Dir(n), j.Log)
+	if err != nil {
+		return err
+	}
+
+	j.Log(LOGDBG, fmt.Sprintf("Moving %s to %s...", o, n))
+	err = os.Rename(o, n)
+	if err == nil {
+		return nil
+	}
+	if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+		return err
+	}
+
+	// Different filesystems
+	return CmdRun(j.Log, "mv", o, n)
+}
+
+func (j *Jailguard) RelocateGuard(n string) error {
+	c := j.GetConfig()
+	o := c.PathData
+
+	n = filepath.Clean(n)
+	err := validateConfigAbsPath(n)
+	if err != nil {
+		return errors.New("New data path " + err.Error())
+	}
+	if n == o || strings.HasPrefix(n, o+"/") || strings.HasPrefix(o, n+"/") {
+		return errors.New("New data path cannot be the current one, within it or its parent")
+	}
+	_, _, err = StatWithLog(n, j.Log)
+	if err == nil {
+		return errors.New(fmt.Sprintf("Path %s already exists", n))
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	// Datasets would have to be renamed and have their mountpoints changed
+	for k, bs := range st.Bases {
+		if bs != nil && bs.Dataset != "" {
+			return errors.New(fmt.Sprintf("Base %s is ZFS dataset %s. Relocating data with datasets is not supported", k, bs.Dataset))
+		}
+	}
+	for k, jl := range st.Jails {
+		if jl != nil && jl.Dir != nil && jl.Dir.Dataset != "" {
+			return errors.New(fmt.Sprintf("Jail %s is ZFS dataset %s. Relocating data with datasets is not supported", k, jl.Dir.Dataset))
+		}
+	}
+
+	jr, err := j.loadJournal()
+	if err != nil {
+		return err
+	}
+	if jr != nil {
+		return errors.New("There is an unfinished operation. Run journal_rollback or journal_resume first")
+	}
+
+	// Jails with source in the data directory have to be stopped before it
+	// is moved
+	stopped := []*Jail{}
+	for k, jl := range st.Jails {
+		if jl == nil || jl.Dir == nil || jl.Config == nil {
+			continue
+		}
+		if relocatePath(jl.Dir.Dirpath, o, n) == jl.Dir.Dirpath && relocatePath(jl.Config.Config["path"], o, n) == jl.Config.Config["path"] {
+			continue
+		}
+		ex, err := JailExistsInOSWithLog(k, j.Log)
+		if err != nil {
+			return err
+		}
+		if !ex {
+			continue
+		}
+		jl.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+		j.Log(LOGINF, fmt.Sprintf("Stopping jail %s...", k))
+		err = jl.Stop()
+		if err != nil {
+			j.startJails(stopped)
+			return errors.New(fmt.Sprintf("Error has occurred while stopping jail %s", k))
+		}
+		stopped = append(stopped, jl)
+	}
+
+	j.Log(LOGINF, fmt.Sprintf("Moving data from %s to %s...", o, n))
+	err = j.moveDataDir(o, n)
+	if err != nil {
+		j.startJails(stopped)
+		return errors.New("Error has occurred while moving data directory: " + err.Error())
+	}
+
+	j.relocateStatePaths(st, o, n)
+
+	err = j.SetConfigValue("path_data", n)
+	if err != nil {
+		j.Log(LOGERR, "Error has occurred while saving the config. Moving data back...")
+		return j.relocateGuardBack(st, o, n, stopped, err)
+	}
+
+	st.AddHistoryEntry("relocate", "state", "", map[string]string{"from": o, "to": n}, nil)
+	err = st.Save()
+	if err != nil {
+		j.Log(LOGERR, "Error has occurred while saving the state. Moving data back...")
+		errCfg := j.SetConfigValue("path_data", o)
+		if errCfg != nil {
+			j.Log(LOGERR, fmt.Sprintf("Error has occurred while reverting the config. Set path_data to %s manually: %s", o, errCfg.Error()))
+		}
+		return j.relocateGuardBack(st, o, n, stopped, err)
+	}
+
+	j.startJails(stopped)
+	j.Log(LOGINF, fmt.Sprintf("Data has been moved to %s", n))
+	return nil
+}
+
+// relocateGuardBack moves data from n back to o after RelocateGuard failed
+// with err, and starts the stopped jails again
+func (j *Jailguard) relocateGuardBack(st *State, o string, n string, stopped []*Jail, err error) error {
+	errBack := j.moveDataDir(n, o)
+	if errBack != nil {
+		j.startJails(stopped)
+		return errors.New(fmt.Sprintf("%s. Data could not be moved back from %s to %s: %s", err.Error(), n, o, errBack.Error()))
+	}
+	j.relocateStatePaths(st, n, o)
+	j.startJails(stopped)
+	return err
+}
+
+// relocateStatePaths changes paths in the state and jail configs from
+// directory o to n. Calling it with o and n swapped reverts the change.
+func (j *Jailguard) relocateStatePaths(st *State, o string, n string) {
+	j.GetConfig().PathData = n
+	st.Filepath = relocatePath(st.Filepath, o, n)
+	for _, bs := range st.Bases {
+		if bs != nil {
+			bs.Dirpath = relocatePath(bs.Dirpath, o, n)
+		}
+	}
+	for k, jl := range st.Jails {
+		if jl == nil || jl.Dir == nil || jl.Config == nil {
+			continue
+		}
+		jl.Dir.Dirpath = relocatePath(jl.Dir.Dirpath, o, n)
+		for _, sn := range jl.Dir.Snapshots {
+			if sn.Filepath != "" {
+				sn.Filepath = relocatePath(sn.Filepath, o, n)
+			}
+		}
+		p := relocatePath(jl.Config.Filepath, o, n)
+		if jl.Config.Config["path"] != "" {
+			jl.Config.Config["path"] = relocatePath(jl.Config.Config["path"], o, n)
+		}
+		if jl.Config.Config["mount.fstab"] != "" {
+			jl.Config.Config["mount.fstab"] = relocatePath(jl.Config.Config["mount.fstab"], o, n)
+		}
+		if jl.GetMode() == JAIL_MODE_THIN {
+			err := j.relocateFstab(jl.Dir.GetFstabPath(), o, n)
+			if err != nil {
+				j.Log(LOGERR, fmt.Sprintf("Error has occurred while relocating fstab of jail %s: %s", k, err.Error()))
+			}
+		}
+		jl.Config.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+		err := jl.Config.Write(p)
+		if err != nil {
+			j.Log(LOGERR, fmt.Sprintf("Error has occurred while writing config of jail %s to %s", k, p))
+		}
+	}
+	if j.lock != nil {
+		j.lock.Filepath = relocatePath(j.lock.Filepath, o, n)
+	}
+}
+
+func (j *Jailguard) startJails(l []*Jail) {
+	for _, jl := range l {
+		j.Log(LOGINF, fmt.Sprintf("Starting jail %s...", jl.Name))
+		err := jl.Start()
+		if err != nil {
+			j.Log(LOGERR, fmt.Sprintf("Error has occurred while starting jail %s", jl.Name))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRelocateGuardThinJail(t *testing.T) {
+	defer newTestCmds().install()()
+	j, cleanup := newTestJailguard(t, "")
+	defer cleanup()
+
+	c := j.GetConfig()
+	o := c.PathData
+	r := c.GetDirPath(c.DirBases) + "/14.1-RELEASE/root"
+	err := os.MkdirAll(r, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, _ := j.getState()
+	dir := NewJailDir("t1", j.getJailDirPath("t1"))
+	dir.SetLogger(j.Log)
+	err = dir.CreateThin(r)
+	if err != nil {
+		t.Fatalf("CreateThin returned error: %s", err.Error())
+	}
+	cfg := NewJailConf()
+	cfg.Name = "t1"
+	cfg.SetLogger(j.Log)
+	cfg.Config["path"] = dir.GetThinRootPath()
+	cfg.Config["mount.fstab"] = dir.GetFstabPath()
+	err = cfg.Write(c.GetDirPath(c.DirConfigs) + "/t1.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jl := NewJail(cfg, dir)
+	jl.Mode = JAIL_MODE_THIN
+	err = dir.TakeSnapshot(NewJailSnapshot("s1", ""), j.getJailSnapshotsDirPath("t1"), jl.Mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.AddJail("t1", jl)
+
+	n := o + "-moved"
+	err = j.RelocateGuard(n)
+	if err != nil {
+		t.Fatalf("RelocateGuard returned error: %s", err.Error())
+	}
+
+	if jl.Config.Config["mount.fstab"] != n+"/jails/t1/fstab" {
+		t.Errorf("mount.fstab has not been relocated: %s", jl.Config.Config["mount.fstab"])
+	}
+	if !strings.HasPrefix(jl.Dir.Snapshots[0].Filepath, n+"/") {
+		t.Errorf("Snapshot has not been relocated: %s", jl.Dir.Snapshots[0].Filepath)
+	}
+	b, err := ioutil.ReadFile(n + "/jails/t1/fstab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), o+"/") || !strings.HasPrefix(string(b), n+"/bases/14.1-RELEASE/root "+n+"/jails/t1/root nullfs ro") {
+		t.Errorf("fstab has not been relocated:\n%s", string(b))
+	}
+	b, _ = ioutil.ReadFile(jl.Config.Filepath)
+	if strings.Contains(string(b), o+"/") {
+		t.Errorf("Jail config has not been relocated:\n%s", string(b))
+	}
+}
+
+func TestRelocateGuardRefusesDatasets(t *testing.T) {
+	defer newTestCmds().install()()
+	j, cleanup := newTestJailguard(t, "")
+	defer cleanup()
+
+	st, _ := j.getState()
+	bs := j.getNewBase("14.1-RELEASE")
+	bs.Dataset = "tank/jailguard/bases/14.1-RELEASE"
+	st.AddBase("14.1-RELEASE", bs)
+
+	o := j.GetConfig().PathData
+	err := j.RelocateGuard(o + "-moved")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("RelocateGuard returned %v, want error about datasets", err)
+	}
+	_, err = os.Stat(o)
+	if err != nil {
+		t.Errorf("Data directory has been moved")
+	}
+}
+
+func TestRelocateGuardMovesBackWhenConfigFails(t *testing.T) {
+	defer newTestCmds().install()()
+	j, cleanup := newTestJailguard(t, "")
+	defer cleanup()
+
+	c := j.GetConfig()
+	o := c.PathData
+	err := ioutil.WriteFile(c.Filepath, []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.RelocateGuard(o + "-moved")
+	if err == nil {
+		t.Fatalf("RelocateGuard did not return error when config could not be saved")
+	}
+	_, err = os.Stat(o)
+	if err != nil {
+		t.Errorf("Data directory has not been moved back")
+	}
+	if c.PathData != o {
+		t.Errorf("path_data has not been reverted: %s", c.PathData)
+	}
+}
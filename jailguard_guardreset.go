@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+func (j *Jailguard) getGuardReset(cls []string) *GuardReset {
+	gr := NewGuardReset(cls)
+	gr.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return gr
+}
+
+func (j *Jailguard) removeJailPFRules(n string) error {
+	p := j.getJailPFRulesFilePath(n)
+	_, _, err := StatWithLog(p, j.Log)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = CmdRun(j.Log, "pfctl", "-a", j.GetConfig().PfAnchor+"/"+n, "-F", "all")
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred while clearing pf anchor of jail %s", n))
+	}
+	return RemoveAllWithLog(p, j.Log)
+}
+
+func (j *Jailguard) planGuardResetPFRules(st *State, gr *GuardReset) {
+	pf := map[string]bool{}
+
+	if gr.Has(GUARDRESET_NATPASS) {
+		ks := []string{}
+		for k, v := range st.JailNATPasses {
+			if v != nil {
+				ks = append(ks, k)
+			}
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			k := k
+			pf[k] = true
+			gr.Add(fmt.Sprintf("Remove NAT pass of jail %s", k), func() error {
+				return st.DeleteItem("jailnatpass", k)
+			})
+		}
+	}
+
+	if gr.Has(GUARDRESET_PORTFWD) {
+		ks := []string{}
+		for k, v := range st.JailPortFwds {
+			if v != nil {
+				ks = append(ks, k)
+			}
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			k := k
+			pf[st.JailPortFwds[k].DstJail] = true
+			gr.Add(fmt.Sprintf("Remove port forwarding %s", k), func() error {
+				return st.DeleteItem("jailportfwd", k)
+			})
+		}
+	}
+
+	// Jails that are removed get their pf rules cleared anyway
+	ks := []string{}
+	for k := range pf {
+		if st.Jails[k] != nil && !gr.Has(GUARDRESET_JAIL) {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		jl := st.Jails[k]
+		gr.Add(fmt.Sprintf("Reload pf rules of jail %s", k), func() error {
+			jl.SetLogger(func(t int, s string) {
+				j.Log(t, s)
+			})
+			return j.FlushJailPFRulesFromState(jl, st)
+		})
+	}
+}
+
+func (j *Jailguard) planGuardResetJails(st *State, gr *GuardReset) error {
+	ks := []string{}
+	for k, v := range st.Jails {
+		if v != nil {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		k := k
+		jl := st.Jails[k]
+		jl.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+
+		ex, err := JailExistsInOSWithLog(k, j.Log)
+		if err != nil {
+			return err
+		}
+		if ex {
+			gr.Add(fmt.Sprintf("Stop jail %s", k), func() error {
+				return jl.Stop()
+			})
+		}
+
+		gr.Add(fmt.Sprintf("Remove jail %s with its pf rules, port forwardings, NAT pass and aliases", k), func() error {
+			return j.removeJail(st, jl, true)
+		})
+	}
+	return nil
+}
+
+// Classes that remove state items of a type
+var guardResetItemClasses = map[string]string{
+	"jailnatpass": GUARDRESET_NATPASS,
+	"jailportfwd": GUARDRESET_PORTFWD,
+	"jail":        GUARDRESET_JAIL,
+	"netif":       GUARDRESET_NETIF,
+	"base":        GUARDRESET_BASE,
+}
+
+// checkGuardResetDeps refuses to remove items that are used by items of
+// classes that have not been selected
+func (j *Jailguard) checkGuardResetDeps(st *State, gr *GuardReset) error {
+	sd := NewStateDeps(st)
+	refs := []StateItemRef{}
+	if gr.Has(GUARDRESET_NETIF) {
+		for k, v := range st.Netifs {
+			if v != nil {
+				refs = append(refs, StateItemRef{Type: "netif", Name: k})
+			}
+		}
+	}
+	if gr.Has(GUARDRESET_BASE) {
+		for k, v := range st.Bases {
+			if v != nil {
+				refs = append(refs, StateItemRef{Type: "base", Name: k})
+			}
+		}
+	}
+
+	l := []string{}
+	cls := map[string]bool{}
+	for _, r := range refs {
+		for _, d := range sd.GetDependants(r.Type, r.Name) {
+			if gr.Has(guardResetItemClasses[d.Type]) {
+				continue
+			}
+			l = append(l, fmt.Sprintf("%s (used by %s)", r.String(), d.String()))
+			cls["--"+guardResetItemClasses[d.Type]] = true
+		}
+	}
+	if len(l) == 0 {
+		return nil
+	}
+	sort.Strings(l)
+	fs := []string{}
+	for c := range cls {
+		fs = append(fs, c)
+	}
+	sort.Strings(fs)
+	return errors.New(fmt.Sprintf("Cannot remove items that are still in use: %s. Add %s to remove their users as well", strings.Join(l, ", "), strings.Join(fs, ", ")))
+}
+
+func (j *Jailguard) planGuardReset(st *State, gr *GuardReset) error {
+	err := j.checkGuardResetDeps(st, gr)
+	if err != nil {
+		return err
+	}
+
+	j.planGuardResetPFRules(st, gr)
+
+	if gr.Has(GUARDRESET_JAIL) {
+		err = j.planGuardResetJails(st, gr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if gr.Has(GUARDRESET_NETIF) {
+		ks := []string{}
+		for k, v := range st.Netifs {
+			if v != nil {
+				ks = append(ks, k)
+			}
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			k := k
+			ni := st.Netifs[k]
+			gr.Add(fmt.Sprintf("Destroy network interface %s (%s)", k, ni.SystemName), func() error {
+				ni.SetLogger(func(t int, s string) {
+					j.Log(t, s)
+				})
+				err := ni.Destroy()
+				if err != nil {
+					return err
+				}
+				return st.DeleteItem("netif", k)
+			})
+		}
+	}
+
+	if gr.Has(GUARDRESET_BASE) {
+		ks := []string{}
+		for k, v := range st.Bases {
+			if v != nil {
+				ks = append(ks, k)
+			}
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			k := k
+			bs := st.Bases[k]
+			gr.Add(fmt.Sprintf("Remove base %s", k), func() error {
+				bs.SetLogger(func(t int, s string) {
+					j.Log(t, s)
+				})
+				err := bs.Remove()
+				if err != nil {
+					return err
+				}
+				return st.DeleteItem("base", k)
+			})
+		}
+	}
+	return nil
+}
+
+func (j *Jailguard) ResetGuard(cls []string, dry bool, yes bool) error {
+	if len(cls) == 0 {
+		return errors.New("No resources to remove have been selected")
+	}
+
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	gr := j.getGuardReset(cls)
+	err = j.planGuardReset(st, gr)
+	if err != nil {
+		return err
+	}
+
+	gr.Print(j.cli.GetStdout())
+	if dry || len(gr.Actions) == 0 {
+		return nil
+	}
+
+	return j.applyActionPlan(st, gr.ActionPlan, "Remove all of the above?", yes, "reset", map[string]string{"classes": strings.Join(cls, ",")})
+}
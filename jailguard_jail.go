@@ -3,18 +3,20 @@ package main
 import (
 	"errors"
 	"fmt"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 func (j *Jailguard) getJailDirPath(jl string) string {
 	c := j.GetConfig()
-	return c.PathData + "/" + c.DirJails + "/" + jl
+	return c.GetDirPath(c.DirJails) + "/" + jl
 }
 
 func (j *Jailguard) getConfigFilePath(jl string) string {
 	c := j.GetConfig()
-	return c.PathData + "/" + c.DirConfigs + "/" + jl + ".jail"
+	return c.GetDirPath(c.DirConfigs) + "/" + jl + ".jail"
 }
 
 func (j *Jailguard) getNewJail(cfg *JailConf, dir *JailDir) *Jail {
@@ -26,6 +28,18 @@ func (j *Jailguard) getNewJail(cfg *JailConf, dir *JailDir) *Jail {
 }
 
 func (j *Jailguard) getJailConf(f string) (*JailConf, error) {
+	cfg, err := j.parseJailConf(f)
+	if err != nil {
+		return nil, err
+	}
+	err = j.completeJailConf(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (j *Jailguard) parseJailConf(f string) (*JailConf, error) {
 	cfg := NewJailConf()
 	cfg.SetLogger(func(t int, s string) {
 		j.Log(t, s)
@@ -34,9 +48,14 @@ func (j *Jailguard) getJailConf(f string) (*JailConf, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = cfg.Validate()
+	return cfg, nil
+}
+
+// completeJailConf validates jail config and sets default values
+func (j *Jailguard) completeJailConf(cfg *JailConf) error {
+	err := cfg.Validate()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if cfg.Config["host.hostname"] == "" {
@@ -50,7 +69,7 @@ func (j *Jailguard) getJailConf(f string) (*JailConf, error) {
 		cfg.Config["exec.stop"] = "/bin/sh /etc/rc.shutdown"
 	}
 
-	return cfg, nil
+	return nil
 }
 
 func (j *Jailguard) getJailDir(n string, d string) *JailDir {
@@ -125,7 +144,7 @@ func (j *Jailguard) StopJail(n string) error {
 		return errors.New("Error stopping jail")
 	}
 
-	st.AddHistoryEntry(fmt.Sprintf("Stop jail %s", n))
+	st.AddHistoryEntry("stop", "jail", n, nil, nil)
 
 	err = st.Save()
 	if err != nil {
@@ -158,7 +177,7 @@ func (j *Jailguard) StartJail(n string) error {
 		return errors.New("Error starting jail")
 	}
 
-	st.AddHistoryEntry(fmt.Sprintf("Start jail %s", n))
+	st.AddHistoryEntry("start", "jail", n, nil, nil)
 
 	err = st.Save()
 	if err != nil {
@@ -187,20 +206,11 @@ func (j *Jailguard) RemoveJail(n string, stop bool) error {
 		return nil
 	}
 
-	if ex && stop {
-		err = jl.Stop()
-		if err != nil {
-			return errors.New("Error stopping jail")
-		}
-	}
-
-	err = jl.Remove()
+	err = j.removeJail(st, jl, stop)
 	if err != nil {
-		return errors.New("Error removing jail")
+		return err
 	}
 
-	st.RemoveItem("jail", n)
-
 	err = st.Save()
 	if err != nil {
 		return err
@@ -210,89 +220,289 @@ func (j *Jailguard) RemoveJail(n string, stop bool) error {
 
 }
 
-func (j *Jailguard) CreateJail(f string, rls string, start bool) error {
-	cfg, err := j.getJailConf(f)
+// prepareJailDir checks that jail directory does not exist yet and sets its
+// dataset when jails are on ZFS
+func (j *Jailguard) prepareJailDir(tx *Transaction, dir *JailDir) error {
+	if !tx.IsDone("create_dir") {
+		_, _, err := StatWithLog(dir.Dirpath, j.Log)
+		if err == nil {
+			return errors.New(fmt.Sprintf("Jail directory %s already exists", dir.Dirpath))
+		}
+	}
+	ds, err := j.getJailDataset(dir.Name)
 	if err != nil {
 		return err
 	}
+	dir.Dataset = ds
+	return nil
+}
 
-	dir := j.getJailDir(cfg.Name, j.getJailDirPath(cfg.Name))
+func (j *Jailguard) getCreateDirUndo(dir *JailDir) []*JournalAction {
+	undo := []*JournalAction{}
+	if dir.Dataset != "" {
+		undo = append(undo, NewJournalAction(JOURNAL_UNDO_DESTROY_DATASET, map[string]string{"dataset": dir.Dataset}))
+		// Dataset of the jails directory is created together with the
+		// first jail one
+		pds := path.Dir(dir.Dataset)
+		if !j.getZFS().Exists(pds) {
+			undo = append(undo, NewJournalAction(JOURNAL_UNDO_DESTROY_DATASET, map[string]string{"dataset": pds}))
+		}
+	}
+	return append(undo, NewJournalAction(JOURNAL_UNDO_REMOVE_PATH, map[string]string{"path": dir.Dirpath}))
+}
 
-	st, jl, ex, err := j.getJailAndCheckIfExistsInOS(cfg.Name, j.Log)
+func (j *Jailguard) CreateJail(f string, rls string, sets string, start bool, insecure bool, thin bool, tplName string) error {
+	cfg, err := j.parseJailConf(f)
 	if err != nil {
 		return err
 	}
-	if jl != nil {
-		return errors.New(fmt.Sprintf("Jail %s already exists in state file", cfg.Name))
+
+	if tplName == "" {
+		tplName = cfg.Config[JAILCONF_JAILGUARD_PREFIX+"template"]
+		if tplName != "" && !IsValidTemplateName(tplName) {
+			return errors.New(fmt.Sprintf("Invalid template name '%s' in the file", tplName))
+		}
 	}
-	if ex {
-		return errors.New(fmt.Sprintf("Jail %s already exists in the system", cfg.Name))
+	var tpl *Template
+	if tplName != "" {
+		if cfg.Config["path"] != "" {
+			return errors.New("'path' cannot be provided in the file when creating jail from template")
+		}
+		tpl, err = j.getTemplate(tplName)
+		if err != nil {
+			return err
+		}
+		if tpl == nil {
+			return errors.New(fmt.Sprintf("Template %s does not exist", tplName))
+		}
+		err = tpl.ApplyJailFile(cfg)
+		if err != nil {
+			return err
+		}
 	}
 
-	var errCreateDir error
-	var errWriteCfg error
+	err = j.completeJailConf(cfg)
+	if err != nil {
+		return err
+	}
 
-	if cfg.Config["path"] == "" {
-		if rls == "" {
-			rls, err = j.getOSRelease()
-			if err != nil {
-				return errors.New("Error getting OS release")
-			}
-		}
+	if sets == "" {
+		sets = cfg.Config[JAILCONF_JAILGUARD_PREFIX+"sets"]
+	}
+	setList, err := ParseBaseSets(sets)
+	if err != nil {
+		return err
+	}
+	if cfg.Config[JAILCONF_JAILGUARD_PREFIX+"thin"] == "true" {
+		thin = true
+	}
+
+	dir := j.getJailDir(cfg.Name, j.getJailDirPath(cfg.Name))
+	baseSHA256 := ""
 
-		bs, err := st.GetBase(rls)
+	p := map[string]string{"file": f, "release": rls, "sets": sets, "start": strconv.FormatBool(start), "insecure": strconv.FormatBool(insecure), "thin": strconv.FormatBool(thin), "template": tplName}
+	return j.runTransaction("jail_create", p, func(tx *Transaction) error {
+		st, jl, ex, err := j.getJailAndCheckIfExistsInOS(cfg.Name, j.Log)
 		if err != nil {
 			return err
 		}
-		if bs == nil {
-			return errors.New(fmt.Sprintf("Base %s not found in state file", rls))
+		if jl != nil {
+			// State is saved in the last step so it has been done
+			if tx.IsResumed() {
+				j.Log(LOGINF, fmt.Sprintf("Jail %s has been saved in state file before the operation was interrupted", cfg.Name))
+				return nil
+			}
+			return errors.New(fmt.Sprintf("Jail %s already exists in state file", cfg.Name))
+		}
+		if ex && !tx.IsDone("start_jail") {
+			return errors.New(fmt.Sprintf("Jail %s already exists in the system", cfg.Name))
 		}
 
-		bs.SetLogger(func(t int, s string) {
-			j.Log(t, s)
-		})
+		fromBase := cfg.Config["path"] == "" && tpl == nil
+		if tpl != nil {
+			if rls != "" || sets != "" || thin {
+				j.Log(LOGINF, "Jail is created from template so base, sets and thin flags will be ignored")
+				thin = false
+			}
 
-		errCreateDir = dir.CreateFromTarball(bs.GetBaseTarballPath())
-		cfg.Config["path"] = j.getJailDirPath(cfg.Name)
-	} else {
-		if rls != "" {
-			j.Log(LOGINF, "'path' is provided in the file so base flag will be ignored")
-		}
-	}
+			if !tx.IsDone("create_dir") && !insecure {
+				if tpl.Verify() != nil {
+					return errors.New(fmt.Sprintf("Template %s is corrupted. Create it again or use --insecure flag", tplName))
+				}
+			}
 
-	j.Log(LOGDBG, "Writing jail config to a file...")
-	errWriteCfg = cfg.Write(j.getConfigFilePath(cfg.Name))
+			err = j.prepareJailDir(tx, dir)
+			if err != nil {
+				return err
+			}
+			err = tx.Step("create_dir", func() error {
+				err := dir.CreateFromTarballs([]string{tpl.GetTarballPath()})
+				if err != nil {
+					return errors.New("Error creating jail source directory")
+				}
+				return nil
+			}, j.getCreateDirUndo(dir)...)
+			if err != nil {
+				return err
+			}
+			cfg.Config["path"] = j.getJailDirPath(cfg.Name)
+		} else if fromBase {
+			if rls == "" {
+				rls, err = j.getOSRelease()
+				if err != nil {
+					return errors.New("Error getting OS release")
+				}
+			}
 
-	jl = j.getNewJail(cfg, dir)
-	if errWriteCfg != nil || errCreateDir != nil {
-		jl.CleanAfterError()
-	}
+			bs, err := st.GetBase(rls)
+			if err != nil {
+				return err
+			}
+			if bs == nil {
+				return errors.New(fmt.Sprintf("Base %s not found in state file", rls))
+			}
 
-	if errCreateDir != nil {
-		return errors.New("Error creating jail source directory")
-	}
-	if errWriteCfg != nil {
-		return errors.New("Error creating config file")
-	}
+			bs.SetLogger(func(t int, s string) {
+				j.Log(t, s)
+			})
 
-	st.AddJail(cfg.Name, jl)
+			m := bs.GetMissingSets(setList)
+			if len(m) > 0 {
+				return errors.New(fmt.Sprintf("Base %s does not have sets: %s. Download them with base_download --sets", rls, strings.Join(m, ", ")))
+			}
 
-	err = st.Save()
-	if err != nil {
-		return errors.New("Jail has been created but there was an error with writing state. Try to import the state of the jail using state_import")
-	}
+			if !tx.IsDone("create_dir") && !insecure {
+				if bs.ManifestGenerated {
+					return errors.New(fmt.Sprintf("Base %s has been imported without MANIFEST and cannot be verified. Import it with MANIFEST or use --insecure flag", rls))
+				}
+				if !bs.Verified || bs.Verify() != nil {
+					return errors.New(fmt.Sprintf("Base %s has not been verified or is corrupted. Run base_verify or use --insecure flag", rls))
+				}
+			}
+
+			baseSHA256 = bs.GetSHA256()
 
-	if start {
-		j.Log(LOGDBG, "Starting jail")
-		err1 := jl.Start()
-		err2 := st.Save()
-		if err2 != nil {
-			return errors.New("Error has occurred while saving state")
+			// Root must not change under the thin jails that mount it
+			rootShared := !tx.IsDone("extract_base_root") && len(bs.GetMissingRootSets(setList)) > 0 && len(j.getThinJailsOfBase(st, rls)) > 0
+			if thin && rootShared {
+				return errors.New(fmt.Sprintf("Root of base %s is shared by thin jails %s and does not have sets: %s. Create the jail without them or remove the thin jails first", rls, strings.Join(j.getThinJailsOfBase(st, rls), ", "), strings.Join(bs.GetMissingRootSets(setList), ", ")))
+			}
+
+			err = j.prepareJailDir(tx, dir)
+			if err != nil {
+				return err
+			}
+			clone := !thin && !rootShared && bs.Dataset != "" && dir.Dataset != ""
+			if thin || clone {
+				err = tx.Step("extract_base_root", func() error {
+					return bs.ExtractRoot(setList)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			err = tx.Step("create_dir", func() error {
+				var err error
+				if thin {
+					err = dir.CreateThin(bs.GetRootPath())
+				} else if clone && bs.GetRootSnapshot(setList) != "" {
+					err = dir.CreateFromSnapshot(bs.GetRootSnapshot(setList))
+				} else {
+					ts := []string{}
+					for _, s := range setList {
+						ts = append(ts, bs.GetSetTarballPath(s))
+					}
+					err = dir.CreateFromTarballs(ts)
+				}
+				if err != nil {
+					return errors.New("Error creating jail source directory")
+				}
+				return nil
+			}, j.getCreateDirUndo(dir)...)
+			if err != nil {
+				return err
+			}
+			if clone {
+				dir.Origin = bs.GetRootSnapshot(setList)
+			}
+			if thin {
+				cfg.Config["path"] = dir.GetThinRootPath()
+				cfg.Config["mount.fstab"] = dir.GetFstabPath()
+			} else {
+				cfg.Config["path"] = j.getJailDirPath(cfg.Name)
+			}
+		} else {
+			if rls != "" {
+				j.Log(LOGINF, "'path' is provided in the file so base flag will be ignored")
+			}
+			if sets != "" {
+				j.Log(LOGINF, "'path' is provided in the file so sets will be ignored")
+			}
+			if thin {
+				j.Log(LOGINF, "'path' is provided in the file so jail cannot be thin")
+				thin = false
+			}
 		}
-		if err1 != nil {
-			return errors.New("Error has occurred while starting jail")
+
+		undo, err := j.getRestoreFileUndo(j.getConfigFilePath(cfg.Name))
+		if err != nil {
+			return err
+		}
+		err = tx.Step("write_config", func() error {
+			j.Log(LOGDBG, "Writing jail config to a file...")
+			err := cfg.Write(j.getConfigFilePath(cfg.Name))
+			if err != nil {
+				return errors.New("Error creating config file")
+			}
+			return nil
+		}, undo)
+		if err != nil {
+			return err
 		}
-	}
 
-	return nil
+		jl = j.getNewJail(cfg, dir)
+		jl.Mode = JAIL_MODE_THICK
+		if thin {
+			jl.Mode = JAIL_MODE_THIN
+		}
+		if fromBase {
+			jl.Release = rls
+			jl.Sets = setList
+			jl.BaseSHA256 = baseSHA256
+		}
+		if tpl != nil {
+			jl.Template = tpl.Name
+			jl.Release = tpl.Release
+			jl.Sets = tpl.Sets
+			jl.BaseSHA256 = tpl.BaseSHA256
+		}
+		jl.AddHistoryEntry("create", map[string]string{"release": jl.Release, "template": jl.Template, "sets": strings.Join(jl.Sets, ","), "mode": jl.Mode, "file": f}, nil)
+
+		if start {
+			if tx.IsDone("start_jail") {
+				jl.State = "started"
+			}
+			err = tx.Step("start_jail", func() error {
+				j.Log(LOGDBG, "Starting jail")
+				err := jl.Start()
+				if err != nil {
+					return errors.New("Error has occurred while starting jail")
+				}
+				return nil
+			}, NewJournalAction(JOURNAL_UNDO_STOP_JAIL, map[string]string{"jail": cfg.Name}))
+			if err != nil {
+				return err
+			}
+		}
+
+		st.AddJail(cfg.Name, jl)
+
+		return tx.Step("save_state", func() error {
+			err := st.Save()
+			if err != nil {
+				return errors.New("Error has occurred while saving state")
+			}
+			return nil
+		})
+	})
 }
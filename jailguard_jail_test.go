@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// newTestJailCreate returns Jailguard with base 14.1-RELEASE and a file of
+// jail t1 with zfs commands faked by z when it is not nil
+func newTestJailCreate(t *testing.T, z *testZFS) (*Jailguard, *testCmds, string, func()) {
+	tc := newTestCmds()
+	restore := tc.install()
+	j, cleanup := newTestJailguard(t, "")
+	c := j.GetConfig()
+	if z != nil {
+		c.ZFS = "auto"
+		z.Datasets["tank/jg"] = c.PathData
+		z.install(tc)
+	}
+
+	st, _ := j.getState()
+	bs := j.getNewBase("14.1-RELEASE")
+	var err error
+	bs.Dataset, err = j.getBaseDataset("14.1-RELEASE")
+	if err == nil {
+		err = bs.createDir()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.AddBase("14.1-RELEASE", bs)
+
+	f := c.PathData + "/t1.json"
+	err = ioutil.WriteFile(f, []byte(`{"version":"1","jail":{"name":"t1"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc.Run = []string{}
+	return j, tc, f, func() {
+		cleanup()
+		restore()
+	}
+}
+
+func TestCreateJailClonesBaseRoot(t *testing.T) {
+	z := newTestZFS(map[string]string{})
+	j, tc, f, cleanup := newTestJailCreate(t, z)
+	defer cleanup()
+	d := j.GetConfig().PathData
+
+	err := j.CreateJail(f, "14.1-RELEASE", "", false, true, false, "")
+	if err != nil {
+		t.Fatalf("CreateJail returned error: %s", err.Error())
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"jls -Nn",
+		"zfs create -p tank/jg/bases/14.1-RELEASE/root",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/base.txz -C " + d + "/bases/14.1-RELEASE/root",
+		"zfs snapshot tank/jg/bases/14.1-RELEASE/root@sets_base",
+		"zfs clone -p tank/jg/bases/14.1-RELEASE/root@sets_base tank/jg/jails/t1",
+	})
+
+	st, _ := j.getState()
+	jl := st.Jails["t1"]
+	if jl == nil {
+		t.Fatal("Jail has not been added to the state")
+	}
+	if jl.Dir.Dataset != "tank/jg/jails/t1" || jl.Dir.Origin != "tank/jg/bases/14.1-RELEASE/root@sets_base" {
+		t.Errorf("Jail has dataset '%s' cloned from '%s'", jl.Dir.Dataset, jl.Dir.Origin)
+	}
+}
+
+func TestCreateJailExtractsTarballs(t *testing.T) {
+	j, tc, f, cleanup := newTestJailCreate(t, nil)
+	defer cleanup()
+	d := j.GetConfig().PathData
+
+	st, _ := j.getState()
+	st.Bases["14.1-RELEASE"].Sets = []string{"base", "lib32"}
+
+	err := j.CreateJail(f, "14.1-RELEASE", "base,lib32", false, true, false, "")
+	if err != nil {
+		t.Fatalf("CreateJail returned error: %s", err.Error())
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"jls -Nn",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/base.txz -C " + d + "/jails/t1",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/lib32.txz -C " + d + "/jails/t1",
+	})
+
+	jl := st.Jails["t1"]
+	if jl == nil {
+		t.Fatal("Jail has not been added to the state")
+	}
+	if jl.Dir.Dataset != "" || jl.Dir.Origin != "" {
+		t.Errorf("Jail has dataset '%s' cloned from '%s'", jl.Dir.Dataset, jl.Dir.Origin)
+	}
+}
+
+func TestCreateJailExtractsTarballsWhenRootHasOtherSets(t *testing.T) {
+	z := newTestZFS(map[string]string{})
+	j, tc, f, cleanup := newTestJailCreate(t, z)
+	defer cleanup()
+	d := j.GetConfig().PathData
+
+	st, _ := j.getState()
+	bs := st.Bases["14.1-RELEASE"]
+	bs.Sets = []string{"base", "lib32"}
+	err := bs.ExtractRoot([]string{"base", "lib32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc.Run = []string{}
+	err = j.CreateJail(f, "14.1-RELEASE", "", false, true, false, "")
+	if err != nil {
+		t.Fatalf("CreateJail returned error: %s", err.Error())
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"jls -Nn",
+		"zfs create -p tank/jg/jails/t1",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/base.txz -C " + d + "/jails/t1",
+	})
+	if st.Jails["t1"].Dir.Origin != "" {
+		t.Errorf("Jail has been cloned from '%s'", st.Jails["t1"].Dir.Origin)
+	}
+}
+
+func TestCreateJailDestroysDatasetsOnFailure(t *testing.T) {
+	z := newTestZFS(map[string]string{})
+	j, tc, f, cleanup := newTestJailCreate(t, z)
+	defer cleanup()
+	d := j.GetConfig().PathData
+
+	// Base is not a dataset so jail is created from tarball which fails
+	st, _ := j.getState()
+	st.Bases["14.1-RELEASE"].Dataset = ""
+	tc.Handlers["tar"] = func(a []string) ([]byte, error) {
+		return nil, errors.New("tar failed")
+	}
+
+	err := j.CreateJail(f, "14.1-RELEASE", "", false, true, false, "")
+	if err == nil {
+		t.Fatal("CreateJail has not returned error")
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"jls -Nn",
+		"zfs create -p tank/jg/jails/t1",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/base.txz -C " + d + "/jails/t1",
+		"zfs destroy -r tank/jg/jails/t1",
+		"zfs destroy -r tank/jg/jails",
+		"chflags -R noschg " + d + "/jails/t1",
+	})
+	for ds := range z.Datasets {
+		if strings.HasPrefix(ds, "tank/jg/jails") {
+			t.Errorf("Dataset %s has not been destroyed", ds)
+		}
+	}
+	jr, _ := j.loadJournal()
+	if jr != nil {
+		t.Errorf("Journal has not been removed")
+	}
+}
+
+func TestCreateJailRejectsInvalidTemplateInFile(t *testing.T) {
+	j, _, _, cleanup := newTestJailCreate(t, nil)
+	defer cleanup()
+
+	f := j.GetConfig().PathData + "/t2.json"
+	err := ioutil.WriteFile(f, []byte(`{"version":"1","jail":{"name":"t2","jailguard.template":"../bases/14.1-RELEASE"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CreateJail(f, "", "", false, true, false, "")
+	if err == nil || !strings.Contains(err.Error(), "Invalid template name") {
+		t.Errorf("CreateJail returned %v, want error about invalid template name", err)
+	}
+}
+
+func TestCreateJailDoesNotChangeRootOfThinJails(t *testing.T) {
+	z := newTestZFS(map[string]string{})
+	j, tc, f, cleanup := newTestJailCreate(t, z)
+	defer cleanup()
+	d := j.GetConfig().PathData
+
+	st, _ := j.getState()
+	bs := st.Bases["14.1-RELEASE"]
+	bs.Sets = []string{"base", "lib32"}
+	err := bs.ExtractRoot([]string{"base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jl := NewJail(NewJailConf(), NewJailDir("t0", j.getJailDirPath("t0")))
+	jl.Mode = JAIL_MODE_THIN
+	jl.Release = "14.1-RELEASE"
+	st.AddJail("t0", jl)
+
+	tc.Run = []string{}
+	err = j.CreateJail(f, "14.1-RELEASE", "base,lib32", false, true, true, "")
+	if err == nil || !strings.Contains(err.Error(), "shared by thin jails t0") {
+		t.Fatalf("CreateJail returned %v, want error about root shared by thin jails", err)
+	}
+	if len(bs.RootSets) != 1 {
+		t.Errorf("Sets have been added to the root: %s", strings.Join(bs.RootSets, ","))
+	}
+
+	tc.Run = []string{}
+	err = j.CreateJail(f, "14.1-RELEASE", "base,lib32", false, true, false, "")
+	if err != nil {
+		t.Fatalf("CreateJail returned error: %s", err.Error())
+	}
+	checkTestCmdsRun(t, tc, []string{
+		"jls -Nn",
+		"zfs create -p tank/jg/jails/t1",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/base.txz -C " + d + "/jails/t1",
+		"tar -xvf " + d + "/bases/14.1-RELEASE/lib32.txz -C " + d + "/jails/t1",
+	})
+	if len(bs.RootSets) != 1 {
+		t.Errorf("Sets have been added to the root: %s", strings.Join(bs.RootSets, ","))
+	}
+}
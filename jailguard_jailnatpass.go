@@ -19,34 +19,35 @@ func (j *Jailguard) CreateJailNATPass(n string, if_gw string) error {
 		return err
 	}
 
-	st, jl, _, err := j.getJailAndCheckIfExistsInOS(n, j.Log)
-	if err != nil {
-		return err
-	}
-	if jl == nil {
-		return errors.New(fmt.Sprintf("Jail %s does not exist in state", n))
-	}
-
-	nat := st.GetJailNATPass(n)
-	if nat != nil {
-		return errors.New(fmt.Sprintf("NAT pass for jail %s already exists", n))
-	}
-
-	nat = j.getNewJailNATPass(n, if_gw)
-
-	st.AddJailNATPass(n, nat)
-
-	err = j.FlushJailPFRulesFromState(jl, st)
-	if err != nil {
-		return err
-	}
-
-	err = st.Save()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return j.runTransaction("jailnatpass_create", map[string]string{"jail": n, "gw_if": if_gw}, func(tx *Transaction) error {
+		st, jl, _, err := j.getJailAndCheckIfExistsInOS(n, j.Log)
+		if err != nil {
+			return err
+		}
+		if jl == nil {
+			return errors.New(fmt.Sprintf("Jail %s does not exist in state", n))
+		}
+
+		nat := st.GetJailNATPass(n)
+		if nat != nil {
+			if tx.IsResumed() {
+				j.Log(LOGINF, fmt.Sprintf("NAT pass for jail %s has been saved in state file before the operation was interrupted", n))
+				return nil
+			}
+			return errors.New(fmt.Sprintf("NAT pass for jail %s already exists", n))
+		}
+
+		nat = j.getNewJailNATPass(n, if_gw)
+
+		st.AddJailNATPass(n, nat)
+
+		err = j.flushJailPFRulesFromStateInTx(tx, jl, st)
+		if err != nil {
+			return err
+		}
+
+		return tx.Step("save_state", st.Save)
+	})
 }
 
 func (j *Jailguard) RemoveJailNATPass(n string) error {
@@ -55,32 +56,29 @@ func (j *Jailguard) RemoveJailNATPass(n string) error {
 		return err
 	}
 
-	st, jl, _, err := j.getJailAndCheckIfExistsInOS(n, j.Log)
-	if err != nil {
-		return err
-	}
-	if jl == nil {
-		return errors.New(fmt.Sprintf("Jail %s does not exist in state", n))
-	}
-
-	nat := st.GetJailNATPass(n)
-	if nat == nil {
-		return nil
-	}
+	return j.runTransaction("jailnatpass_remove", map[string]string{"jail": n}, func(tx *Transaction) error {
+		st, jl, _, err := j.getJailAndCheckIfExistsInOS(n, j.Log)
+		if err != nil {
+			return err
+		}
+		if jl == nil {
+			return errors.New(fmt.Sprintf("Jail %s does not exist in state", n))
+		}
 
-	err = st.RemoveItem("jailnatpass", n)
+		nat := st.GetJailNATPass(n)
+		if nat == nil {
+			return nil
+		}
 
-	err = j.FlushJailPFRulesFromState(jl, st)
-	if err != nil {
-		return err
-	}
+		st.DeleteItem("jailnatpass", n)
 
-	err = st.Save()
-	if err != nil {
-		return err
-	}
+		err = j.flushJailPFRulesFromStateInTx(tx, jl, st)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return tx.Step("save_state", st.Save)
+	})
 }
 
 func (j *Jailguard) ShowJailNATPass(n string) error {
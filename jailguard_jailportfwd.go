@@ -19,34 +19,36 @@ func (j *Jailguard) AddJailPortFwd(src_if string, src_port string, dst_jail stri
 		return err
 	}
 
-	st, jl, ex, err := j.getJailAndCheckIfExistsInOS(dst_jail, j.Log)
-	if err != nil {
-		return err
-	}
-	if jl == nil {
-		return errors.New(fmt.Sprintf("Jail %s does not exist in state", dst_jail))
-	}
-
-	ex = st.IsJailPortFwdPrefixExists(fmt.Sprintf("%s__%s__", src_if, src_port))
-	if ex {
-		return errors.New(fmt.Sprintf("Interface %s port %s is already forwarded", src_if, src_port))
-	}
+	p := map[string]string{"src_if": src_if, "src_port": src_port, "dst_jail": dst_jail, "dst_port": dst_port}
+	return j.runTransaction("jailportfwd_add", p, func(tx *Transaction) error {
+		st, jl, ex, err := j.getJailAndCheckIfExistsInOS(dst_jail, j.Log)
+		if err != nil {
+			return err
+		}
+		if jl == nil {
+			return errors.New(fmt.Sprintf("Jail %s does not exist in state", dst_jail))
+		}
 
-	fwd := j.getNewJailPortFwd(src_if, src_port, dst_jail, dst_port)
+		ex = st.IsJailPortFwdPrefixExists(fmt.Sprintf("%s__%s__", src_if, src_port))
+		if ex {
+			if tx.IsResumed() {
+				j.Log(LOGINF, "Port forward has been saved in state file before the operation was interrupted")
+				return nil
+			}
+			return errors.New(fmt.Sprintf("Interface %s port %s is already forwarded", src_if, src_port))
+		}
 
-	st.AddJailPortFwd(fmt.Sprintf("%s__%s__%s__%s", fwd.SrcIf, fwd.SrcPort, fwd.DstJail, fwd.DstPort), fwd)
+		fwd := j.getNewJailPortFwd(src_if, src_port, dst_jail, dst_port)
 
-	err = j.FlushJailPFRulesFromState(jl, st)
-	if err != nil {
-		return err
-	}
+		st.AddJailPortFwd(fmt.Sprintf("%s__%s__%s__%s", fwd.SrcIf, fwd.SrcPort, fwd.DstJail, fwd.DstPort), fwd)
 
-	err = st.Save()
-	if err != nil {
-		return err
-	}
+		err = j.flushJailPFRulesFromStateInTx(tx, jl, st)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return tx.Step("save_state", st.Save)
+	})
 }
 
 func (j *Jailguard) DeleteJailPortFwd(src_if string, src_port string, dst_jail string, dst_port string) error {
@@ -55,32 +57,30 @@ func (j *Jailguard) DeleteJailPortFwd(src_if string, src_port string, dst_jail s
 		return err
 	}
 
-	st, jl, _, err := j.getJailAndCheckIfExistsInOS(dst_jail, j.Log)
-	if err != nil {
-		return err
-	}
-	if jl == nil {
-		return errors.New(fmt.Sprintf("Jail %s does not exist in state", dst_jail))
-	}
+	p := map[string]string{"src_if": src_if, "src_port": src_port, "dst_jail": dst_jail, "dst_port": dst_port}
+	return j.runTransaction("jailportfwd_delete", p, func(tx *Transaction) error {
+		st, jl, _, err := j.getJailAndCheckIfExistsInOS(dst_jail, j.Log)
+		if err != nil {
+			return err
+		}
+		if jl == nil {
+			return errors.New(fmt.Sprintf("Jail %s does not exist in state", dst_jail))
+		}
 
-	fwd := st.GetJailPortFwd(fmt.Sprintf("%s__%s__%s__%s", src_if, src_port, dst_jail, dst_port))
-	if fwd == nil {
-		return nil
-	}
+		fwd := st.GetJailPortFwd(fmt.Sprintf("%s__%s__%s__%s", src_if, src_port, dst_jail, dst_port))
+		if fwd == nil {
+			return nil
+		}
 
-	st.RemoveItem("jailportfwd", fmt.Sprintf("%s__%s__%s__%s", fwd.SrcIf, fwd.SrcPort, fwd.DstJail, fwd.DstPort))
+		st.DeleteItem("jailportfwd", fmt.Sprintf("%s__%s__%s__%s", fwd.SrcIf, fwd.SrcPort, fwd.DstJail, fwd.DstPort))
 
-	err = j.FlushJailPFRulesFromState(jl, st)
-	if err != nil {
-		return err
-	}
-
-	err = st.Save()
-	if err != nil {
-		return err
-	}
+		err = j.flushJailPFRulesFromStateInTx(tx, jl, st)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return tx.Step("save_state", st.Save)
+	})
 }
 
 func (j *Jailguard) DeleteJailAllPortFwds(dst_jail string) error {
@@ -89,33 +89,27 @@ func (j *Jailguard) DeleteJailAllPortFwds(dst_jail string) error {
 		return err
 	}
 
-	st, jl, _, err := j.getJailAndCheckIfExistsInOS(dst_jail, j.Log)
-	if err != nil {
-		return err
-	}
-	if jl == nil {
-		return errors.New(fmt.Sprintf("Jail %s does not exist in state", dst_jail))
-	}
-
-	err = nil
-	fwds := st.GetJailPortFwdsFilterJail(dst_jail)
-	for k, _ := range fwds {
-		if err == nil {
-			st.RemoveItem("jailportfwd", k)
+	return j.runTransaction("jailportfwd_delete_all", map[string]string{"dst_jail": dst_jail}, func(tx *Transaction) error {
+		st, jl, _, err := j.getJailAndCheckIfExistsInOS(dst_jail, j.Log)
+		if err != nil {
+			return err
+		}
+		if jl == nil {
+			return errors.New(fmt.Sprintf("Jail %s does not exist in state", dst_jail))
 		}
-	}
 
-	err = j.FlushJailPFRulesFromState(jl, st)
-	if err != nil {
-		return err
-	}
+		fwds := st.GetJailPortFwdsFilterJail(dst_jail)
+		for k, _ := range fwds {
+			st.DeleteItem("jailportfwd", k)
+		}
 
-	err = st.Save()
-	if err != nil {
-		return err
-	}
+		err = j.flushJailPFRulesFromStateInTx(tx, jl, st)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return tx.Step("save_state", st.Save)
+	})
 }
 
 func (j *Jailguard) ListJailPortFwds(n string) error {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+func (j *Jailguard) getJailSnapshotsDirPath(n string) string {
+	c := j.GetConfig()
+	return c.GetDirPath(c.DirSnapshots) + "/" + n
+}
+
+// getJailWithDir returns jail n from the state with its directory
+func (j *Jailguard) getJailWithDir(n string) (*State, *Jail, bool, error) {
+	st, jl, ex, err := j.getJailAndCheckIfExistsInOS(n, j.Log)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if jl == nil {
+		return nil, nil, false, errors.New(fmt.Sprintf("Jail %s does not exist in state file", n))
+	}
+	if jl.Dir == nil {
+		return nil, nil, false, errors.New(fmt.Sprintf("Jail %s does not have a directory", n))
+	}
+	return st, jl, ex, nil
+}
+
+func (j *Jailguard) SnapshotJail(n string, lbl string) error {
+	st, jl, _, err := j.getJailWithDir(n)
+	if err != nil {
+		return err
+	}
+	_, _, err = StatWithLog(jl.Dir.Dirpath, j.Log)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Jail %s directory %s cannot be accessed. Jails with 'path' in the file cannot be snapshotted", n, jl.Dir.Dirpath))
+	}
+
+	sn := NewJailSnapshot(GetJailSnapshotID(jl.Dir.Snapshots, lbl), lbl)
+	p := map[string]string{"snapshot": sn.ID}
+	err = jl.Dir.TakeSnapshot(sn, j.getJailSnapshotsDirPath(n), jl.GetMode())
+	jl.AddHistoryEntry("snapshot", p, err)
+	if err != nil {
+		_ = st.Save()
+		return err
+	}
+	st.AddHistoryEntry("snapshot", "jail", n, p, nil)
+
+	err = st.Save()
+	if err != nil {
+		return err
+	}
+	j.Log(LOGINF, fmt.Sprintf("Snapshot %s of jail %s has been taken", sn.ID, n))
+	return nil
+}
+
+func (j *Jailguard) ListJailSnapshots(n string) error {
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	ns := []string{}
+	if n != "" {
+		if st.Jails[n] == nil {
+			return errors.New(fmt.Sprintf("Jail %s does not exist in state file", n))
+		}
+		ns = append(ns, n)
+	} else {
+		for k := range st.Jails {
+			ns = append(ns, k)
+		}
+		sort.Strings(ns)
+	}
+
+	for _, k := range ns {
+		jl := st.Jails[k]
+		if jl == nil || jl.Dir == nil {
+			continue
+		}
+		for _, sn := range jl.Dir.Snapshots {
+			fmt.Fprintf(j.cli.GetStdout(), "%s %s %s %s\n", k, sn.ID, sn.Type, sn.Created)
+		}
+	}
+	return nil
+}
+
+// RollbackJail restores jail directory from snapshot id stopping the jail
+// for the time of the rollback if it is running
+func (j *Jailguard) RollbackJail(n string, id string) error {
+	st, jl, ex, err := j.getJailWithDir(n)
+	if err != nil {
+		return err
+	}
+	if jl.Dir.GetSnapshot(id) == nil {
+		return errors.New(fmt.Sprintf("Snapshot %s of jail %s does not exist", id, n))
+	}
+
+	p := map[string]string{"snapshot": id}
+	if ex {
+		j.Log(LOGINF, fmt.Sprintf("Stopping jail %s for the rollback...", n))
+		err = jl.Stop()
+		if err != nil {
+			_ = st.Save()
+			return errors.New("Error stopping jail")
+		}
+	}
+
+	err = jl.Dir.Rollback(id)
+	jl.AddHistoryEntry("rollback", p, err)
+	if err != nil {
+		_ = st.Save()
+		return err
+	}
+	st.AddHistoryEntry("rollback", "jail", n, p, nil)
+
+	if ex {
+		j.Log(LOGINF, fmt.Sprintf("Starting jail %s again...", n))
+		err = jl.Start()
+		if err != nil {
+			_ = st.Save()
+			return errors.New("Jail has been rolled back but there was an error starting it")
+		}
+	}
+
+	err = st.Save()
+	if err != nil {
+		return err
+	}
+	j.Log(LOGINF, fmt.Sprintf("Jail %s has been rolled back to snapshot %s", n, id))
+	return nil
+}
+
+func (j *Jailguard) RemoveJailSnapshot(n string, id string) error {
+	st, jl, _, err := j.getJailWithDir(n)
+	if err != nil {
+		return err
+	}
+
+	p := map[string]string{"snapshot": id}
+	err = jl.Dir.RemoveSnapshot(id)
+	if err != nil {
+		return err
+	}
+	jl.AddHistoryEntry("snapshot_remove", p, nil)
+	st.AddHistoryEntry("snapshot_remove", "jail", n, p, nil)
+
+	return st.Save()
+}
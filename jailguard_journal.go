@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+func (j *Jailguard) getJournalFilePath() string {
+	return j.getStateFilePath() + ".journal"
+}
+
+func (j *Jailguard) loadJournal() (*Journal, error) {
+	jr, err := LoadJournal(j.getJournalFilePath())
+	if err != nil {
+		return nil, err
+	}
+	if jr != nil {
+		jr.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+	}
+	return jr, nil
+}
+
+func (j *Jailguard) getTransaction(jr *Journal) *Transaction {
+	tx := NewTransaction(jr, j.undoJournalAction)
+	tx.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return tx
+}
+
+// getRestoreFileUndo returns an action that brings file p back to what it is
+// now
+func (j *Jailguard) getRestoreFileUndo(p string) (*JournalAction, error) {
+	fi, isdir, err := StatWithLog(p, j.Log)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewJournalAction(JOURNAL_UNDO_REMOVE_PATH, map[string]string{"path": p}), nil
+		}
+		return nil, errors.New(fmt.Sprintf("Error has occurred while getting stat for %s", p))
+	}
+	if isdir {
+		return nil, errors.New(fmt.Sprintf("Path %s is a directory", p))
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error has occurred while reading %s", p))
+	}
+	return NewJournalAction(JOURNAL_UNDO_WRITE_FILE, map[string]string{
+		"path":    p,
+		"content": string(b),
+		"mode":    strconv.FormatUint(uint64(fi.Mode().Perm()), 8),
+	}), nil
+}
+
+func (j *Jailguard) undoJournalAction(a *JournalAction) error {
+	switch a.Type {
+	case JOURNAL_UNDO_REMOVE_PATH:
+		p := a.Params["path"]
+		_, _, err := StatWithLog(p, j.Log)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		_ = CmdRun(j.Log, "chflags", "-R", "noschg", p)
+		return RemoveAllWithLog(p, j.Log)
+	case JOURNAL_UNDO_WRITE_FILE:
+		m, err := strconv.ParseUint(a.Params["mode"], 8, 32)
+		if err != nil {
+			m = 0644
+		}
+		return WriteFileAtomicWithLog(a.Params["path"], []byte(a.Params["content"]), os.FileMode(m), j.Log)
+	case JOURNAL_UNDO_STOP_JAIL:
+		ex, err := JailExistsInOSWithLog(a.Params["jail"], j.Log)
+		if err != nil {
+			return err
+		}
+		if !ex {
+			return nil
+		}
+		return CmdRun(j.Log, "jail", "-r", a.Params["jail"])
+	case JOURNAL_UNDO_RELOAD_PF_RULES:
+		_, _, err := StatWithLog(j.getJailPFRulesFilePath(a.Params["jail"]), j.Log)
+		if err != nil && os.IsNotExist(err) {
+			return CmdRun(j.Log, "pfctl", "-a", j.GetConfig().PfAnchor+"/"+a.Params["jail"], "-F", "all")
+		}
+		return j.FlushJailPFRulesFromFile(a.Params["jail"])
+	case JOURNAL_UNDO_DESTROY_DATASET:
+		z := j.getZFS()
+		if !z.Exists(a.Params["dataset"]) {
+			return nil
+		}
+		return z.Destroy(a.Params["dataset"])
+	}
+	return errors.New(fmt.Sprintf("Unknown undo action '%s'", a.Type))
+}
+
+func (j *Jailguard) beginTransaction(op string, p map[string]string) (*Transaction, error) {
+	_, err := j.getState()
+	if err != nil {
+		return nil, err
+	}
+
+	if j.journal != nil && j.journal.Operation == op {
+		tx := j.getTransaction(j.journal)
+		tx.SetResumed(true)
+		return tx, nil
+	}
+
+	jr, err := j.loadJournal()
+	if err != nil {
+		return nil, err
+	}
+	if jr != nil {
+		return nil, errors.New(fmt.Sprintf("Operation '%s' started on %s has not finished. Run journal_rollback or journal_resume first", jr.Operation, jr.Started))
+	}
+
+	jr = NewJournal(j.getJournalFilePath(), op, p)
+	jr.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return j.getTransaction(jr), nil
+}
+
+// runTransaction runs fn within a transaction that is rolled back when fn
+// fails
+func (j *Jailguard) runTransaction(op string, p map[string]string, fn func(*Transaction) error) error {
+	tx, err := j.beginTransaction(op, p)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		j.Log(LOGINF, fmt.Sprintf("Operation '%s' has failed, undoing the steps that have been done...", op))
+		err2 := tx.Rollback()
+		if err2 != nil {
+			j.Log(LOGERR, err2.Error())
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (j *Jailguard) ShowJournal() error {
+	_, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	jr, err := j.loadJournal()
+	if err != nil {
+		return err
+	}
+	if jr == nil {
+		j.Log(LOGINF, "There is no unfinished operation")
+		return nil
+	}
+	jr.Print(j.cli.GetStdout())
+	return nil
+}
+
+func (j *Jailguard) RollbackJournal() error {
+	_, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	jr, err := j.loadJournal()
+	if err != nil {
+		return err
+	}
+	if jr == nil {
+		return errors.New("There is no unfinished operation")
+	}
+
+	err = j.getTransaction(jr).Rollback()
+	if err != nil {
+		return err
+	}
+	j.Log(LOGINF, fmt.Sprintf("Operation '%s' has been rolled back", jr.Operation))
+	return nil
+}
+
+func (j *Jailguard) ResumeJournal() error {
+	_, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	jr, err := j.loadJournal()
+	if err != nil {
+		return err
+	}
+	if jr == nil {
+		return errors.New("There is no unfinished operation")
+	}
+
+	err = j.getTransaction(jr).UndoUnfinished()
+	if err != nil {
+		return err
+	}
+
+	j.journal = jr
+	j.Log(LOGINF, fmt.Sprintf("Resuming operation '%s'...", jr.Operation))
+
+	p := jr.Params
+	switch jr.Operation {
+	case "jail_create":
+		err = j.CreateJail(p["file"], p["release"], p["sets"], p["start"] == "true", p["insecure"] == "true", p["thin"] == "true", p["template"])
+	case "jailportfwd_add":
+		err = j.AddJailPortFwd(p["src_if"], p["src_port"], p["dst_jail"], p["dst_port"])
+	case "jailportfwd_delete":
+		err = j.DeleteJailPortFwd(p["src_if"], p["src_port"], p["dst_jail"], p["dst_port"])
+	case "jailportfwd_delete_all":
+		err = j.DeleteJailAllPortFwds(p["dst_jail"])
+	case "jailnatpass_create":
+		err = j.CreateJailNATPass(p["jail"], p["gw_if"])
+	case "jailnatpass_remove":
+		err = j.RemoveJailNATPass(p["jail"])
+	default:
+		return errors.New(fmt.Sprintf("Operation '%s' cannot be resumed. Run journal_rollback", jr.Operation))
+	}
+	if err != nil {
+		return err
+	}
+	j.Log(LOGINF, fmt.Sprintf("Operation '%s' has been finished", jr.Operation))
+	return nil
+}
@@ -43,7 +43,7 @@ func (j *Jailguard) CreateNetif(n string, ip_begin string, ip_end string, if_n s
 	return nil
 }
 
-func (j *Jailguard) DestroyNetif(n string) error {
+func (j *Jailguard) DestroyNetif(n string, cascade bool) error {
 	st, err := j.getState()
 	if err != nil {
 		return err
@@ -60,12 +60,17 @@ func (j *Jailguard) DestroyNetif(n string) error {
 		j.Log(t, s)
 	})
 
+	err = j.removeDependants(st, "netif", n, cascade)
+	if err != nil {
+		return err
+	}
+
 	err = ni.Destroy()
 	if err != nil {
 		return err
 	}
 
-	st.RemoveItem("netif", n)
+	st.DeleteItem("netif", n)
 
 	err = st.Save()
 	if err != nil {
@@ -105,7 +110,7 @@ func (j *Jailguard) AddNetifAlias(n string, ip string) error {
 	return nil
 }
 
-func (j *Jailguard) DeleteNetifAlias(n string, ip string) error {
+func (j *Jailguard) DeleteNetifAlias(n string, ip string, cascade bool) error {
 	st, err := j.getState()
 	if err != nil {
 		return err
@@ -122,6 +127,11 @@ func (j *Jailguard) DeleteNetifAlias(n string, ip string) error {
 		j.Log(t, s)
 	})
 
+	err = j.removeDependants(st, "netif_alias", GetNetifAliasRefName(n, ip), cascade)
+	if err != nil {
+		return err
+	}
+
 	err = ni.DeleteAlias(ip)
 	if err != nil {
 		return err
@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 )
 
 func (j *Jailguard) getJailPFRulesFilePath(jl string) string {
 	c := j.GetConfig()
-	return c.PathData + "/" + c.DirConfigs + "/" + jl + ".pf"
+	return c.GetDirPath(c.DirConfigs) + "/" + jl + ".pf"
 }
 
 func (j *Jailguard) FlushJailPFRulesFromState(jl *Jail, st *State) error {
@@ -26,29 +27,56 @@ func (j *Jailguard) FlushJailPFRulesFromState(jl *Jail, st *State) error {
 	return nil
 }
 
-func (j *Jailguard) RecreateJailPFRulesFromState(jl *Jail, st *State) error {
-	// This function is performed before state is saved so everything needs to be
-	// checked if it is not nil
+func (j *Jailguard) flushJailPFRulesFromStateInTx(tx *Transaction, jl *Jail, st *State) error {
+	undo, err := j.getRestoreFileUndo(j.getJailPFRulesFilePath(jl.Name))
+	if err != nil {
+		return err
+	}
+
+	return tx.Step("flush_pf_rules", func() error {
+		return j.FlushJailPFRulesFromState(jl, st)
+	}, undo, NewJournalAction(JOURNAL_UNDO_RELOAD_PF_RULES, map[string]string{"jail": jl.Name}))
+}
+
+func (j *Jailguard) getJailPFRules(jl *Jail, st *State) string {
 	c := ""
 	if jl.Config.Config["ip4.addr"] != "" {
 		nat := st.GetJailNATPass(jl.Name)
 		fwds := st.GetJailPortFwdsFilterJail(jl.Name)
 
 		if nat != nil && nat.GwIf != "" {
-			jl.logger(LOGDBG, fmt.Sprintf("Checking if gateway network interface %s exists...", nat.GwIf))
-			err := CmdRun(jl.logger, "ifconfig", nat.GwIf)
-			if err != nil {
-				return errors.New(fmt.Sprintf("Gateway network interface %s does not exist", nat.GwIf))
-			}
 			c += fmt.Sprintf("nat pass on %s from %s/32 to any -> (%s:0)\n", nat.GwIf, jl.Config.Config["ip4.addr"], nat.GwIf)
 		}
 
-		for _, v := range fwds {
+		ks := []string{}
+		for k := range fwds {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			v := fwds[k]
 			if v != nil {
 				c += fmt.Sprintf("rdr pass on %s inet proto tcp from any to (%s:0) port %s -> %s port %s\n", v.SrcIf, v.SrcIf, v.SrcPort, jl.Config.Config["ip4.addr"], v.DstPort)
 			}
 		}
 	}
+	return c
+}
+
+func (j *Jailguard) RecreateJailPFRulesFromState(jl *Jail, st *State) error {
+	// This function is performed before state is saved so everything needs to be
+	// checked if it is not nil
+	if jl.Config.Config["ip4.addr"] != "" {
+		nat := st.GetJailNATPass(jl.Name)
+		if nat != nil && nat.GwIf != "" {
+			jl.logger(LOGDBG, fmt.Sprintf("Checking if gateway network interface %s exists...", nat.GwIf))
+			err := CmdRun(jl.logger, "ifconfig", nat.GwIf)
+			if err != nil {
+				return errors.New(fmt.Sprintf("Gateway network interface %s does not exist", nat.GwIf))
+			}
+		}
+	}
+	c := j.getJailPFRules(jl, st)
 
 	j.Log(LOGDBG, fmt.Sprintf("Writing jail pf rules file to %s...", j.getJailPFRulesFilePath(jl.Name)))
 	err := ioutil.WriteFile(j.getJailPFRulesFilePath(jl.Name), []byte(c), 0644)
@@ -82,3 +110,12 @@ func (j *Jailguard) FlushJailPFRulesFromFile(n string) error {
 
 	return nil
 }
+
+func (j *Jailguard) getJailLoadedPFRules(n string) (string, error) {
+	c := j.GetConfig()
+	out, err := CmdOut(j.Log, "pfctl", "-a", c.PfAnchor+"/"+n, "-s", "nat")
+	if err != nil {
+		return "", errors.New("Error has occurred while getting jail pf rules loaded in the anchor")
+	}
+	return string(out), nil
+}
@@ -3,14 +3,61 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 )
 
 func (j *Jailguard) getStateFilePath() string {
 	c := j.GetConfig()
-	return c.PathData + "/" + c.DirState + "/" + c.FileState
+	return c.GetDirPath(c.DirState) + "/" + c.FileState
 }
 
+func (j *Jailguard) getHistoryArchiveDirPath() string {
+	c := j.GetConfig()
+	return c.GetDirPath(c.DirState) + "/history"
+}
+
+func (j *Jailguard) getHistoryArchive() *HistoryArchive {
+	ha := NewHistoryArchive(j.getHistoryArchiveDirPath())
+	ha.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return ha
+}
+
+func (j *Jailguard) getStateLockFilePath() string {
+	return j.getStateFilePath() + ".lock"
+}
+
+// getState loads the state while holding an exclusive lock on it so that
+// other jailguard processes cannot change it until this one exits. State is
+// loaded only once per run and the same instance is returned afterwards.
 func (j *Jailguard) getState() (*State, error) {
+	if j.state != nil {
+		return j.state, nil
+	}
+
+	lck := NewFileLock(j.getStateLockFilePath())
+	lck.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	err := lck.Lock()
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := j.loadState()
+	if err != nil {
+		lck.Unlock()
+		return nil, err
+	}
+
+	j.state = st
+	j.lock = lck
+	return st, nil
+}
+
+func (j *Jailguard) loadState() (*State, error) {
 	st, err := NewState(j.getStateFilePath())
 	if err != nil {
 		return nil, err
@@ -18,9 +65,32 @@ func (j *Jailguard) getState() (*State, error) {
 	st.SetLogger(func(t int, s string) {
 		j.Log(t, s)
 	})
+	st.SetBeforeSave(func() error {
+		return j.takeAutoStateSnapshot()
+	})
+	c := j.GetConfig()
+	st.SetHistoryRetention(c.HistoryMaxEntries, time.Duration(c.HistoryMaxAge)*24*time.Hour, j.getHistoryArchive().Append)
+
+	v, bak := st.GetMigratedFrom()
+	if v > 0 {
+		j.Log(LOGINF, fmt.Sprintf("State has been migrated from version %d to %d. Previous state file has been saved as %s", v, STATE_VERSION, bak))
+		st.AddHistoryEntry("migrate", "state", "", map[string]string{"from": strconv.Itoa(v), "to": strconv.Itoa(STATE_VERSION)}, nil)
+		err = st.Save()
+		if err != nil {
+			return nil, err
+		}
+	}
 	return st, nil
 }
 
+func (j *Jailguard) releaseState() {
+	if j.lock != nil {
+		j.lock.Unlock()
+	}
+	j.lock = nil
+	j.state = nil
+}
+
 func (j *Jailguard) RemoveStateItem(t string, n string) error {
 	st, err := j.getState()
 	if err != nil {
@@ -46,7 +116,7 @@ func (j *Jailguard) ImportStateItem(t string, n string) error {
 			return err
 		}
 		if bs != nil {
-			j.Log(LOGERR, fmt.Sprintf("Base %s already exists. Remove it first before importing a new one"))
+			j.Log(LOGERR, fmt.Sprintf("Base %s already exists. Remove it first before importing a new one", n))
 			return errors.New("State item already exists")
 		}
 
@@ -63,7 +133,7 @@ func (j *Jailguard) ImportStateItem(t string, n string) error {
 			return err
 		}
 		if jl != nil {
-			j.Log(LOGERR, fmt.Sprintf("Jail %s already exists. Remove it first before import a new one"))
+			j.Log(LOGERR, fmt.Sprintf("Jail %s already exists. Remove it first before import a new one", n))
 			return errors.New("State item already exists")
 		}
 
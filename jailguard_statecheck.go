@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func (j *Jailguard) getStateCheck() *StateCheck {
+	sc := NewStateCheck()
+	sc.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return sc
+}
+
+func (j *Jailguard) getDirEntries(p string, dirs bool, sfx string) ([]string, error) {
+	l := []string{}
+	fis, err := ioutil.ReadDir(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, errors.New(fmt.Sprintf("Error has occurred while reading directory %s", p))
+	}
+	for _, fi := range fis {
+		if fi.IsDir() != dirs || !strings.HasSuffix(fi.Name(), sfx) {
+			continue
+		}
+		l = append(l, strings.TrimSuffix(fi.Name(), sfx))
+	}
+	return l, nil
+}
+
+func (j *Jailguard) checkStateBases(st *State, sc *StateCheck) error {
+	ks := []string{}
+	for k := range st.Bases {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		bs := st.Bases[k]
+		status := STATECHECK_OK
+		details := ""
+		for _, s := range bs.GetSets() {
+			_, isdir, err := StatWithLog(bs.GetSetTarballPath(s), j.Log)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					return errors.New(fmt.Sprintf("Error has occurred while checking base %s", k))
+				}
+				status = STATECHECK_MISSING_IN_OS
+				details = fmt.Sprintf("%s not found", bs.GetSetTarballPath(s))
+				break
+			} else if isdir {
+				status = STATECHECK_MISMATCH
+				details = fmt.Sprintf("%s is a directory", bs.GetSetTarballPath(s))
+				break
+			}
+		}
+		sc.Add("base", k, "", status, details)
+	}
+
+	c := j.GetConfig()
+	ds, err := j.getDirEntries(c.GetDirPath(c.DirBases), true, "")
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if st.Bases[d] == nil {
+			sc.Add("base", d, "", STATECHECK_MISSING_IN_STATE, fmt.Sprintf("directory %s not found in state", j.getBaseDirPath(d)))
+		}
+	}
+	return nil
+}
+
+func (j *Jailguard) checkStateJails(st *State, sc *StateCheck) error {
+	ks := []string{}
+	for k := range st.Jails {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		jl := st.Jails[k]
+
+		p := jl.Dir.Dirpath
+		if jl.Config.Config["path"] != "" {
+			p = jl.Config.Config["path"]
+		}
+		_, _, err := StatWithLog(p, j.Log)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return errors.New(fmt.Sprintf("Error has occurred while checking jail %s", k))
+			}
+			sc.Add("jail", k, "", STATECHECK_MISSING_IN_OS, fmt.Sprintf("directory %s not found", p))
+			continue
+		}
+
+		_, _, err = StatWithLog(jl.Config.Filepath, j.Log)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return errors.New(fmt.Sprintf("Error has occurred while checking jail %s", k))
+			}
+			sc.Add("jail", k, "", STATECHECK_MISSING_IN_OS, fmt.Sprintf("config %s not found", jl.Config.Filepath))
+			continue
+		}
+
+		ex, err := JailExistsInOSWithLog(k, j.Log)
+		if err != nil {
+			return err
+		}
+		if ex && jl.State != "started" {
+			sc.Add("jail", k, "", STATECHECK_MISMATCH, fmt.Sprintf("jail is running but state is '%s'", jl.State))
+		} else if !ex && jl.State == "started" {
+			sc.Add("jail", k, "", STATECHECK_MISMATCH, "state is 'started' but jail is not running")
+		} else {
+			sc.Add("jail", k, "", STATECHECK_OK, "")
+		}
+	}
+
+	c := j.GetConfig()
+	ds, err := j.getDirEntries(c.GetDirPath(c.DirJails), true, "")
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if st.Jails[d] == nil {
+			sc.Add("jail", d, "", STATECHECK_MISSING_IN_STATE, fmt.Sprintf("directory %s not found in state", j.getJailDirPath(d)))
+		}
+	}
+
+	fs, err := j.getDirEntries(c.GetDirPath(c.DirConfigs), false, ".jail")
+	if err != nil {
+		return err
+	}
+	for _, f := range fs {
+		if st.Jails[f] == nil {
+			sc.Add("jail", f, "", STATECHECK_MISSING_IN_STATE, fmt.Sprintf("config %s not found in state", j.getConfigFilePath(f)))
+		}
+	}
+	return nil
+}
+
+func (j *Jailguard) checkStateNetifs(st *State, sc *StateCheck) error {
+	ks := []string{}
+	for k := range st.Netifs {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		ni := st.Netifs[k]
+		ni.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+
+		as, ex, err := ni.GetOSAliases()
+		if err != nil {
+			return err
+		}
+		if !ex {
+			sc.Add("netif", k, "", STATECHECK_MISSING_IN_OS, fmt.Sprintf("interface %s not found", ni.SystemName))
+			continue
+		}
+		sc.Add("netif", k, "", STATECHECK_OK, "")
+
+		m := map[string]bool{}
+		for _, a := range as {
+			m[a] = true
+		}
+		for _, a := range ni.Aliases {
+			if m[a] {
+				sc.Add("netif_alias", a, k, STATECHECK_OK, "")
+				delete(m, a)
+			} else {
+				sc.Add("netif_alias", a, k, STATECHECK_MISSING_IN_OS, fmt.Sprintf("alias not found on %s", ni.SystemName))
+			}
+		}
+		for _, a := range as {
+			if m[a] {
+				sc.Add("netif_alias", a, k, STATECHECK_MISSING_IN_STATE, fmt.Sprintf("alias found on %s", ni.SystemName))
+			}
+		}
+	}
+	return nil
+}
+
+func (j *Jailguard) isPFRuleLoaded(rls string, re *regexp.Regexp) bool {
+	for _, l := range strings.Split(rls, "\n") {
+		if re.MatchString(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Jailguard) countPFRules(rls string) int {
+	i := 0
+	for _, l := range strings.Split(rls, "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "nat ") || strings.HasPrefix(l, "rdr ") {
+			i++
+		}
+	}
+	return i
+}
+
+func (j *Jailguard) checkStatePFRules(st *State, sc *StateCheck) error {
+	ks := []string{}
+	for k := range st.Jails {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		jl := st.Jails[k]
+		jl.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+		exp := j.getJailPFRules(jl, st)
+
+		f := ""
+		fex := true
+		b, err := ioutil.ReadFile(j.getJailPFRulesFilePath(k))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return errors.New(fmt.Sprintf("Error has occurred while reading pf rules of jail %s", k))
+			}
+			if exp == "" {
+				continue
+			}
+			fex = false
+		} else {
+			f = string(b)
+		}
+
+		loaded, err := j.getJailLoadedPFRules(k)
+		if err != nil {
+			return err
+		}
+
+		if !fex {
+			sc.Add("jail_pf", k, "", STATECHECK_MISSING_IN_OS, fmt.Sprintf("%s not found", j.getJailPFRulesFilePath(k)))
+		} else if !j.hasSameLines(f, exp) {
+			sc.Add("jail_pf", k, "", STATECHECK_MISMATCH, fmt.Sprintf("%s differs from state", j.getJailPFRulesFilePath(k)))
+		} else if j.countPFRules(loaded) != j.countPFRules(exp) {
+			sc.Add("jail_pf", k, "", STATECHECK_MISMATCH, fmt.Sprintf("%d rules loaded in anchor, %d expected", j.countPFRules(loaded), j.countPFRules(exp)))
+		} else {
+			sc.Add("jail_pf", k, "", STATECHECK_OK, "")
+		}
+
+		ip := regexp.QuoteMeta(jl.Config.Config["ip4.addr"])
+		nat := st.GetJailNATPass(k)
+		if nat != nil {
+			gw := regexp.QuoteMeta(nat.GwIf)
+			re := regexp.MustCompile(fmt.Sprintf(`nat pass on %s .*from %s(/32)? to any -> \(%s(:0)?\)`, gw, ip, gw))
+			if ip != "" && j.isPFRuleLoaded(loaded, re) {
+				sc.Add("jailnatpass", k, "", STATECHECK_OK, "")
+			} else {
+				sc.Add("jailnatpass", k, "", STATECHECK_MISSING_IN_OS, "rule not loaded in pf anchor")
+			}
+		}
+
+		fwds := st.GetJailPortFwdsFilterJail(k)
+		fks := []string{}
+		for fk := range fwds {
+			fks = append(fks, fk)
+		}
+		sort.Strings(fks)
+		for _, fk := range fks {
+			v := fwds[fk]
+			re := regexp.MustCompile(fmt.Sprintf(`rdr pass on %s .*port = %s -> %s port %s`, regexp.QuoteMeta(v.SrcIf), regexp.QuoteMeta(v.SrcPort), ip, regexp.QuoteMeta(v.DstPort)))
+			if ip != "" && j.isPFRuleLoaded(loaded, re) {
+				sc.Add("jailportfwd", fk, "", STATECHECK_OK, "")
+			} else {
+				sc.Add("jailportfwd", fk, "", STATECHECK_MISSING_IN_OS, "rule not loaded in pf anchor")
+			}
+		}
+	}
+
+	for k, v := range st.JailPortFwds {
+		if st.Jails[v.DstJail] == nil {
+			sc.Add("jailportfwd", k, "", STATECHECK_MISMATCH, fmt.Sprintf("jail %s not found in state", v.DstJail))
+		}
+	}
+	for k := range st.JailNATPasses {
+		if st.Jails[k] == nil {
+			sc.Add("jailnatpass", k, "", STATECHECK_MISMATCH, fmt.Sprintf("jail %s not found in state", k))
+		}
+	}
+	return nil
+}
+
+func (j *Jailguard) hasSameLines(a string, b string) bool {
+	la := strings.Split(strings.TrimSpace(a), "\n")
+	lb := strings.Split(strings.TrimSpace(b), "\n")
+	sort.Strings(la)
+	sort.Strings(lb)
+	return strings.Join(la, "\n") == strings.Join(lb, "\n")
+}
+
+func (j *Jailguard) CheckState() (*StateCheck, error) {
+	st, err := j.getState()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := j.getStateCheck()
+
+	j.Log(LOGDBG, "Checking bases...")
+	err = j.checkStateBases(st, sc)
+	if err != nil {
+		return nil, err
+	}
+	j.Log(LOGDBG, "Checking jails...")
+	err = j.checkStateJails(st, sc)
+	if err != nil {
+		return nil, err
+	}
+	j.Log(LOGDBG, "Checking network interfaces...")
+	err = j.checkStateNetifs(st, sc)
+	if err != nil {
+		return nil, err
+	}
+	j.Log(LOGDBG, "Checking pf rules...")
+	err = j.checkStatePFRules(st, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+func (j *Jailguard) PrintStateCheck() (bool, error) {
+	sc, err := j.CheckState()
+	if err != nil {
+		return false, err
+	}
+	sc.Print(j.cli.GetStdout())
+	return sc.HasDrift(), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// removeDependants refuses to go on when there are items depending on item
+// of type t and name n, unless cascade is set in which case the dependant
+// jails get removed. State is saved after each removed jail so that it still
+// matches the system when a later removal fails.
+func (j *Jailguard) removeDependants(st *State, t string, n string, cascade bool) error {
+	ds := NewStateDeps(st).GetDependants(t, n)
+	if len(ds) == 0 {
+		return nil
+	}
+
+	l := []string{}
+	for _, d := range ds {
+		l = append(l, d.String())
+	}
+	if !cascade {
+		return errors.New(fmt.Sprintf("%s %s is used by: %s. Remove them first or use --cascade", t, n, strings.Join(l, ", ")))
+	}
+
+	for _, d := range ds {
+		if d.Type != "jail" || st.Jails[d.Name] == nil {
+			continue
+		}
+		j.Log(LOGINF, fmt.Sprintf("Removing jail %s that uses %s %s...", d.Name, t, n))
+		err := j.removeJail(st, st.Jails[d.Name], true)
+		if err != nil {
+			return err
+		}
+		err = st.Save()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeJail removes jail together with its pf rules, port forwardings, NAT
+// pass and netif aliases that no other jail uses. State is not saved.
+func (j *Jailguard) removeJail(st *State, jl *Jail, stop bool) error {
+	n := jl.Name
+	jl.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	jl.Config.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	jl.Dir.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+
+	ex, err := JailExistsInOSWithLog(n, j.Log)
+	if err != nil {
+		return err
+	}
+	if ex {
+		if !stop {
+			return errors.New("Please stop jail first or use --stop")
+		}
+		err = jl.Stop()
+		if err != nil {
+			return errors.New("Error stopping jail")
+		}
+	}
+
+	err = jl.Remove()
+	if err != nil {
+		return errors.New("Error removing jail")
+	}
+
+	err = j.removeJailPFRules(n)
+	if err != nil {
+		j.Log(LOGERR, fmt.Sprintf("Jail %s has been removed but its pf rules could not be cleared: %s", n, err.Error()))
+	}
+
+	sd := NewStateDeps(st)
+	for _, d := range sd.GetDependants("jail", n) {
+		st.DeleteItem(d.Type, d.Name)
+	}
+
+	for nn, ni := range st.Netifs {
+		if ni == nil {
+			continue
+		}
+		ni.SetLogger(func(t int, s string) {
+			j.Log(t, s)
+		})
+		for _, ip := range GetJailIPv4Addrs(jl) {
+			ds := sd.GetDependants("netif_alias", GetNetifAliasRefName(nn, ip))
+			if len(ds) != 1 || ds[0].Name != n {
+				continue
+			}
+			err = ni.DeleteAlias(ip)
+			if err != nil {
+				j.Log(LOGERR, fmt.Sprintf("Jail %s has been removed but its alias %s could not be deleted from %s: %s", n, ip, nn, err.Error()))
+			}
+		}
+	}
+
+	return st.DeleteItem("jail", n)
+}
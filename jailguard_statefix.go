@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func (j *Jailguard) getStateFix(towards string) *StateFix {
+	sf := NewStateFix(towards)
+	sf.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return sf
+}
+
+func (j *Jailguard) planStateFixTowardsOS(st *State, sc *StateCheck, sf *StateFix) {
+	pf := map[string]bool{}
+	for _, it := range sc.GetDrift() {
+		it := it
+		switch it.Type {
+		case "base":
+			bs := st.Bases[it.Name]
+			if it.Status == STATECHECK_MISSING_IN_OS {
+				sf.Add(fmt.Sprintf("Download base %s again", it.Name), func() error {
+					bs.SetLogger(func(t int, s string) {
+						j.Log(t, s)
+					})
+					bs.SetMirrors(j.GetConfig().GetMirrors())
+					bs.SetDownloader(j.getNewDownloader())
+					return bs.Download(true)
+				})
+			} else if it.Status == STATECHECK_MISSING_IN_STATE {
+				sf.Skip(fmt.Sprintf("base %s is not in the state, import it with state_import", it.Name))
+			} else {
+				sf.Skip(fmt.Sprintf("base %s: %s", it.Name, it.Details))
+			}
+		case "jail":
+			jl := st.Jails[it.Name]
+			if it.Status == STATECHECK_MISSING_IN_STATE {
+				sf.Skip(fmt.Sprintf("jail %s is not in the state, import it with state_import", it.Name))
+			} else if it.Status == STATECHECK_MISSING_IN_OS {
+				p := jl.Dir.Dirpath
+				if jl.Config.Config["path"] != "" {
+					p = jl.Config.Config["path"]
+				}
+				_, _, err := StatWithLog(p, j.Log)
+				if err != nil {
+					sf.Skip(fmt.Sprintf("jail %s directory is missing, jail has to be created again", it.Name))
+					continue
+				}
+				sf.Add(fmt.Sprintf("Write config file of jail %s", it.Name), func() error {
+					jl.Config.SetLogger(func(t int, s string) {
+						j.Log(t, s)
+					})
+					return jl.Config.Write(jl.Config.Filepath)
+				})
+			} else if jl.State == "started" {
+				sf.Add(fmt.Sprintf("Start jail %s", it.Name), func() error {
+					jl.SetLogger(func(t int, s string) {
+						j.Log(t, s)
+					})
+					return jl.Start()
+				})
+			} else {
+				sf.Add(fmt.Sprintf("Stop jail %s", it.Name), func() error {
+					jl.SetLogger(func(t int, s string) {
+						j.Log(t, s)
+					})
+					return jl.Stop()
+				})
+			}
+		case "netif":
+			ni := st.Netifs[it.Name]
+			sf.Add(fmt.Sprintf("Create network interface %s and add its aliases", ni.SystemName), func() error {
+				ni.SetLogger(func(t int, s string) {
+					j.Log(t, s)
+				})
+				return ni.Recreate()
+			})
+		case "netif_alias":
+			ni := st.Netifs[it.Parent]
+			if it.Status == STATECHECK_MISSING_IN_OS {
+				sf.Add(fmt.Sprintf("Add alias %s to network interface %s", it.Name, ni.SystemName), func() error {
+					return ni.RecreateAlias(it.Name)
+				})
+			} else {
+				sf.Add(fmt.Sprintf("Delete alias %s from network interface %s", it.Name, ni.SystemName), func() error {
+					return ni.RemoveOSAlias(it.Name)
+				})
+			}
+		case "jail_pf", "jailportfwd", "jailnatpass":
+			n := it.Name
+			if it.Type == "jailportfwd" && st.JailPortFwds[it.Name] != nil {
+				n = st.JailPortFwds[it.Name].DstJail
+			}
+			jl := st.Jails[n]
+			if jl == nil {
+				sf.Skip(fmt.Sprintf("%s %s refers to jail %s that does not exist in the state", it.Type, it.Name, n))
+				continue
+			}
+			if pf[n] {
+				continue
+			}
+			pf[n] = true
+			sf.Add(fmt.Sprintf("Load pf rules of jail %s from the state", n), func() error {
+				return j.FlushJailPFRulesFromState(jl, st)
+			})
+		}
+	}
+}
+
+func (j *Jailguard) planStateFixTowardsState(st *State, sc *StateCheck, sf *StateFix) {
+	imported := map[string]bool{}
+	for _, it := range sc.GetDrift() {
+		it := it
+		switch it.Type {
+		case "base":
+			if it.Status == STATECHECK_MISSING_IN_OS {
+				sf.Add(fmt.Sprintf("Remove base %s from the state", it.Name), func() error {
+					return st.RemoveItem("base", it.Name)
+				})
+			} else if it.Status == STATECHECK_MISSING_IN_STATE {
+				sf.Add(fmt.Sprintf("Import base %s into the state", it.Name), func() error {
+					bs := j.getNewBase(it.Name)
+					err := bs.Import()
+					if err != nil {
+						return err
+					}
+					st.AddBase(it.Name, bs)
+					return nil
+				})
+			} else {
+				sf.Skip(fmt.Sprintf("base %s: %s", it.Name, it.Details))
+			}
+		case "jail":
+			if it.Status == STATECHECK_MISSING_IN_OS {
+				sf.Add(fmt.Sprintf("Remove jail %s with its port forwardings and NAT pass from the state", it.Name), func() error {
+					for k := range st.GetJailPortFwdsFilterJail(it.Name) {
+						st.RemoveItem("jailportfwd", k)
+					}
+					if st.GetJailNATPass(it.Name) != nil {
+						st.RemoveItem("jailnatpass", it.Name)
+					}
+					return st.RemoveItem("jail", it.Name)
+				})
+			} else if it.Status == STATECHECK_MISSING_IN_STATE {
+				if imported[it.Name] {
+					continue
+				}
+				imported[it.Name] = true
+				_, _, err1 := StatWithLog(j.getJailDirPath(it.Name), j.Log)
+				_, _, err2 := StatWithLog(j.getConfigFilePath(it.Name), j.Log)
+				if err1 != nil || err2 != nil {
+					sf.Skip(fmt.Sprintf("jail %s cannot be imported because its directory or config is missing", it.Name))
+					continue
+				}
+				sf.Add(fmt.Sprintf("Import jail %s into the state", it.Name), func() error {
+					return j.ImportStateItem("jail", it.Name)
+				})
+			} else {
+				jl := st.Jails[it.Name]
+				s := "started"
+				if jl.State == "started" {
+					s = "stopped"
+				}
+				sf.Add(fmt.Sprintf("Mark jail %s as %s", it.Name, s), func() error {
+					jl.State = s
+					jl.AddHistoryEntry("mark", map[string]string{"state": s}, nil)
+					return nil
+				})
+			}
+		case "netif":
+			sf.Add(fmt.Sprintf("Remove network interface %s from the state", it.Name), func() error {
+				return st.RemoveItem("netif", it.Name)
+			})
+		case "netif_alias":
+			ni := st.Netifs[it.Parent]
+			if it.Status == STATECHECK_MISSING_IN_OS {
+				sf.Add(fmt.Sprintf("Remove alias %s of network interface %s from the state", it.Name, it.Parent), func() error {
+					ni.RemoveAliasFromState(it.Name)
+					return nil
+				})
+			} else {
+				sf.Add(fmt.Sprintf("Add alias %s of network interface %s to the state", it.Name, it.Parent), func() error {
+					ni.AddAliasToState(it.Name)
+					return nil
+				})
+			}
+		case "jail_pf", "jailportfwd", "jailnatpass":
+			if it.Status == STATECHECK_MISMATCH && it.Type != "jail_pf" {
+				sf.Add(fmt.Sprintf("Remove %s %s from the state", it.Type, it.Name), func() error {
+					return st.RemoveItem(it.Type, it.Name)
+				})
+				continue
+			}
+			sf.Skip(fmt.Sprintf("%s %s: pf rules cannot be read back into the state, use --towards=os", it.Type, it.Name))
+		}
+	}
+}
+
+func (j *Jailguard) confirm(q string) bool {
+	fmt.Fprintf(j.cli.GetStdout(), "%s [y/N] ", q)
+	r := bufio.NewReader(os.Stdin)
+	l, err := r.ReadString('\n')
+	if err != nil && l == "" {
+		return false
+	}
+	l = strings.ToLower(strings.TrimSpace(l))
+	return l == "y" || l == "yes"
+}
+
+func (j *Jailguard) FixState(towards string, yes bool) error {
+	if towards != STATEFIX_TOWARDS_OS && towards != STATEFIX_TOWARDS_STATE {
+		return errors.New("Invalid direction. Use 'os' or 'state'")
+	}
+
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	sc, err := j.CheckState()
+	if err != nil {
+		return err
+	}
+
+	sf := j.getStateFix(towards)
+	if towards == STATEFIX_TOWARDS_OS {
+		j.planStateFixTowardsOS(st, sc, sf)
+	} else {
+		j.planStateFixTowardsState(st, sc, sf)
+	}
+
+	sf.Print(j.cli.GetStdout())
+	if len(sf.Actions) == 0 {
+		j.Log(LOGINF, "Nothing to fix")
+		return nil
+	}
+
+	return j.applyActionPlan(st, sf.ActionPlan, "Apply the changes?", yes, "fix", map[string]string{"towards": towards})
+}
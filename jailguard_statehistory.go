@@ -0,0 +1,19 @@
+package main
+
+func (j *Jailguard) QueryStateHistory(hq *HistoryQuery, archived bool, asJSON bool) error {
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	hs := st.GetHistoryEntries()
+	if archived {
+		as, err := j.getHistoryArchive().ReadAll()
+		if err != nil {
+			return err
+		}
+		hs = append(as, hs...)
+	}
+
+	return PrintHistoryEntries(j.cli.GetStdout(), hq.Run(hs), asJSON)
+}
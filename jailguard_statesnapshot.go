@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+func (j *Jailguard) getStateSnapshotsDirPath() string {
+	c := j.GetConfig()
+	return c.GetDirPath(c.DirState) + "/snapshots"
+}
+
+func (j *Jailguard) getStateSnapshots() *StateSnapshots {
+	ss := NewStateSnapshots(j.getStateSnapshotsDirPath(), j.GetConfig().FileState)
+	ss.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return ss
+}
+
+func (j *Jailguard) takeAutoStateSnapshot() error {
+	ss := j.getStateSnapshots()
+	sn, err := ss.Take(j.getStateFilePath(), STATESNAPSHOT_AUTO_LABEL)
+	if err != nil {
+		return err
+	}
+	if sn != nil {
+		j.Log(LOGDBG, fmt.Sprintf("State snapshot %s has been taken", sn.ID))
+	}
+	return ss.PruneLabel(STATESNAPSHOT_AUTO_LABEL, STATESNAPSHOT_AUTO_KEEP)
+}
+
+// reloadState reads the state file again while keeping the lock
+func (j *Jailguard) reloadState() (*State, error) {
+	if j.lock == nil {
+		return j.getState()
+	}
+	st, err := j.loadState()
+	if err != nil {
+		return nil, err
+	}
+	j.state = st
+	return st, nil
+}
+
+func (j *Jailguard) TakeStateSnapshot(lbl string) error {
+	_, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	if lbl == STATESNAPSHOT_AUTO_LABEL {
+		return errors.New(fmt.Sprintf("Label '%s' is reserved for automatic snapshots", lbl))
+	}
+
+	sn, err := j.getStateSnapshots().Take(j.getStateFilePath(), lbl)
+	if err != nil {
+		return err
+	}
+	if sn == nil {
+		return errors.New("State file does not exist")
+	}
+	j.Log(LOGINF, fmt.Sprintf("State snapshot %s has been taken", sn.ID))
+	return nil
+}
+
+func (j *Jailguard) ListStateSnapshots() error {
+	return j.getStateSnapshots().Print(j.cli.GetStdout())
+}
+
+func (j *Jailguard) RollbackState(id string, show bool) error {
+	_, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	ss := j.getStateSnapshots()
+	sn, err := ss.Get(id)
+	if err != nil {
+		return err
+	}
+	if sn == nil {
+		return errors.New(fmt.Sprintf("State snapshot %s does not exist", id))
+	}
+
+	b, err := ioutil.ReadFile(sn.Filepath)
+	if err != nil {
+		return errors.New("Error has occurred while reading state snapshot: " + err.Error())
+	}
+
+	prev, err := ss.Take(j.getStateFilePath(), "rollback")
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		j.Log(LOGINF, fmt.Sprintf("Current state has been saved as snapshot %s", prev.ID))
+	}
+
+	err = WriteFileAtomicWithLog(j.getStateFilePath(), b, 0644, j.Log)
+	if err != nil {
+		return errors.New("Error has occurred while restoring state snapshot: " + err.Error())
+	}
+
+	st, err := j.reloadState()
+	if err != nil {
+		return err
+	}
+	st.AddHistoryEntry("rollback", "state", "", map[string]string{"snapshot": id}, nil)
+	st.SetBeforeSave(nil)
+	err = st.Save()
+	if err != nil {
+		return err
+	}
+	j.Log(LOGINF, fmt.Sprintf("State has been rolled back to snapshot %s", id))
+
+	if show {
+		sc, err := j.CheckState()
+		if err != nil {
+			return err
+		}
+		if !sc.HasDrift() {
+			j.Log(LOGINF, "System matches the restored state")
+			return nil
+		}
+		sf := j.getStateFix(STATEFIX_TOWARDS_OS)
+		j.planStateFixTowardsOS(st, sc, sf)
+		sf.Print(j.cli.GetStdout())
+		j.Log(LOGINF, "Run 'state_fix --towards=os' to apply the changes")
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func (j *Jailguard) getTemplatesDirPath() string {
+	c := j.GetConfig()
+	return c.GetDirPath(c.DirTemplates)
+}
+
+func (j *Jailguard) getNewTemplate(n string) *Template {
+	t := NewTemplate(n, j.getTemplatesDirPath()+"/"+n)
+	t.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return t
+}
+
+// getTemplate returns template n or nil when it does not exist
+func (j *Jailguard) getTemplate(n string) (*Template, error) {
+	t := j.getNewTemplate(n)
+	ex, err := t.Load()
+	if err != nil {
+		return nil, err
+	}
+	if !ex {
+		return nil, nil
+	}
+	return t, nil
+}
+
+func (j *Jailguard) CreateTemplate(n string, jail string, ow bool) error {
+	st, jl, ex, err := j.getJailAndCheckIfExistsInOS(jail, j.Log)
+	if err != nil {
+		return err
+	}
+	if jl == nil {
+		return errors.New(fmt.Sprintf("Jail %s does not exist in state file", jail))
+	}
+	if jl.GetMode() != JAIL_MODE_THICK {
+		return errors.New("Template can only be created from a thick jail")
+	}
+	if jl.Dir == nil || jl.Config == nil {
+		return errors.New(fmt.Sprintf("Jail %s does not have a directory or config", jail))
+	}
+	_, _, err = StatWithLog(jl.Dir.Dirpath, j.Log)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Jail %s directory %s cannot be accessed. Jails with 'path' in the file cannot be used as templates", jail, jl.Dir.Dirpath))
+	}
+
+	old, err := j.getTemplate(n)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if !ow {
+			return errors.New(fmt.Sprintf("Template %s already exists. Use 'overwrite' flag to create it again", n))
+		}
+		j.Log(LOGINF, fmt.Sprintf("Template %s already exists but creating it again...", n))
+	}
+	if ex {
+		j.Log(LOGINF, fmt.Sprintf("Jail %s is running so files that are being written might not be captured consistently", jail))
+	}
+
+	t := j.getNewTemplate(n)
+	if old != nil {
+		// Existing template is replaced only when the new one is created
+		t.Dirpath = j.getTemplatesDirPath() + "/." + n + ".new"
+		_ = RemoveAllWithLog(t.Dirpath, j.Log)
+	}
+	t.SourceJail = jail
+	t.Release = jl.Release
+	t.Sets = jl.Sets
+	t.BaseSHA256 = jl.BaseSHA256
+	p := map[string]string{"jail": jail}
+	err = t.Create(jl.Dir, jl.Config)
+	if err != nil {
+		st.AddHistoryEntry("create", "template", n, p, err)
+		_ = st.Save()
+		return err
+	}
+	if old != nil {
+		err = j.replaceTemplate(old, t)
+		if err != nil {
+			st.AddHistoryEntry("create", "template", n, p, err)
+			_ = st.Save()
+			return err
+		}
+	}
+	st.AddHistoryEntry("create", "template", n, p, nil)
+
+	err = st.Save()
+	if err != nil {
+		return err
+	}
+	j.Log(LOGINF, fmt.Sprintf("Template %s has been created from jail %s", n, jail))
+	return nil
+}
+
+// replaceTemplate moves template t in place of template old and removes old
+func (j *Jailguard) replaceTemplate(old *Template, t *Template) error {
+	p := old.Dirpath
+	tmp := j.getTemplatesDirPath() + "/." + old.Name + ".old"
+	_ = RemoveAllWithLog(tmp, j.Log)
+	err := os.Rename(p, tmp)
+	if err != nil {
+		_ = t.Remove()
+		return errors.New("Error has occurred when replacing existing template: " + err.Error())
+	}
+	err = os.Rename(t.Dirpath, p)
+	if err != nil {
+		_ = os.Rename(tmp, p)
+		_ = t.Remove()
+		return errors.New("Error has occurred when replacing existing template: " + err.Error())
+	}
+	t.Dirpath = p
+	old.Dirpath = tmp
+	err = old.Remove()
+	if err != nil {
+		j.Log(LOGERR, fmt.Sprintf("Error has occurred when removing previous template directory %s", tmp))
+	}
+	return nil
+}
+
+func (j *Jailguard) ListTemplates() error {
+	_, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(j.getTemplatesDirPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.New("Error has occurred while reading templates directory: " + err.Error())
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		t, err := j.getTemplate(fi.Name())
+		if err != nil {
+			j.Log(LOGERR, err.Error())
+			continue
+		}
+		if t == nil {
+			continue
+		}
+		rls := t.Release
+		if rls == "" {
+			rls = "-"
+		}
+		fmt.Fprintf(j.cli.GetStdout(), "template %s jail %s release %s sets %s\n", t.Name, t.SourceJail, rls, strings.Join(t.Sets, ","))
+	}
+	return nil
+}
+
+func (j *Jailguard) RemoveTemplate(n string) error {
+	st, err := j.getState()
+	if err != nil {
+		return err
+	}
+
+	t, err := j.getTemplate(n)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errors.New(fmt.Sprintf("Template %s does not exist", n))
+	}
+
+	err = t.Remove()
+	st.AddHistoryEntry("remove", "template", n, nil, err)
+	if err != nil {
+		_ = st.Save()
+		return errors.New("Error has occurred while removing template. Please remove the directory manually")
+	}
+	return st.Save()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCreateTemplateOverwriteKeepsOldOnError(t *testing.T) {
+	tc := newTestCmds()
+	defer tc.install()()
+	j, cleanup := newTestJailguard(t, "")
+	defer cleanup()
+
+	st, _ := j.getState()
+	dir := NewJailDir("t1", j.getJailDirPath("t1"))
+	err := os.MkdirAll(dir.Dirpath, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewJailConf()
+	cfg.Name = "t1"
+	cfg.Config["path"] = dir.Dirpath
+	st.AddJail("t1", NewJail(cfg, dir))
+
+	sum := "first"
+	tc.Handlers["tar"] = func(a []string) ([]byte, error) {
+		return []byte{}, ioutil.WriteFile(a[4], []byte(sum), 0644)
+	}
+	err = j.CreateTemplate("tpl", "t1", false)
+	if err != nil {
+		t.Fatalf("CreateTemplate returned error: %s", err.Error())
+	}
+	tpl, _ := j.getTemplate("tpl")
+	first := tpl.SHA256
+
+	tc.Handlers["tar"] = func(a []string) ([]byte, error) {
+		return []byte{}, errors.New("No space left on device")
+	}
+	err = j.CreateTemplate("tpl", "t1", true)
+	if err == nil {
+		t.Fatalf("CreateTemplate did not return error when archiving failed")
+	}
+	tpl, _ = j.getTemplate("tpl")
+	if tpl == nil || tpl.SHA256 != first || tpl.Verify() != nil {
+		t.Errorf("Existing template has been modified by failed overwrite")
+	}
+
+	sum = "second"
+	tc.Handlers["tar"] = func(a []string) ([]byte, error) {
+		return []byte{}, ioutil.WriteFile(a[4], []byte(sum), 0644)
+	}
+	err = j.CreateTemplate("tpl", "t1", true)
+	if err != nil {
+		t.Fatalf("CreateTemplate returned error: %s", err.Error())
+	}
+	tpl, _ = j.getTemplate("tpl")
+	if tpl == nil || tpl.SHA256 == first || tpl.Verify() != nil {
+		t.Errorf("Template has not been overwritten")
+	}
+	fis, _ := ioutil.ReadDir(j.getTemplatesDirPath())
+	if len(fis) != 1 {
+		t.Errorf("Templates directory contains %d entries, want 1", len(fis))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testMirror serves files from a map and records requested paths
+type testMirror struct {
+	Files    map[string][]byte
+	Requests []string
+
+	mu  sync.Mutex
+	srv *httptest.Server
+}
+
+func (m *testMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.Requests = append(m.Requests, r.URL.Path)
+	b, ok := m.Files[r.URL.Path]
+	m.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(b)
+}
+
+func (m *testMirror) URL() string {
+	return m.srv.URL
+}
+
+func (m *testMirror) Close() {
+	m.srv.Close()
+}
+
+func newTestMirror() *testMirror {
+	m := &testMirror{Files: map[string][]byte{}, Requests: []string{}}
+	m.srv = httptest.NewServer(m)
+	return m
+}
+
+// addTestRelease adds MANIFEST and set files with contents cs to mirror m
+func addTestRelease(m *testMirror, rls string, arch string, cs map[string]string) {
+	mf := ""
+	for s, c := range cs {
+		f := s + ".txz"
+		m.Files[GetBaseURL("", rls, arch, f)] = []byte(c)
+		mf += fmt.Sprintf("%s\t%x\t1\t%s\tdesc\ton\n", f, sha256.Sum256([]byte(c)), s)
+	}
+	m.Files[GetBaseURL("", rls, arch, "MANIFEST")] = []byte(mf)
+}
+
+// testCmds fakes external commands. Commands without a handler succeed
+// with no output.
+type testCmds struct {
+	Handlers map[string]func([]string) ([]byte, error)
+	Run      []string
+}
+
+func (tc *testCmds) run(c string, a ...string) ([]byte, error) {
+	tc.Run = append(tc.Run, strings.TrimSpace(c+" "+strings.Join(a, " ")))
+	if h, ok := tc.Handlers[c]; ok {
+		return h(a)
+	}
+	return []byte{}, nil
+}
+
+// install replaces CmdRunner and returns a function that restores it
+func (tc *testCmds) install() func() {
+	orig := CmdRunner
+	CmdRunner = tc.run
+	return func() {
+		CmdRunner = orig
+	}
+}
+
+func newTestCmds() *testCmds {
+	return &testCmds{Handlers: map[string]func([]string) ([]byte, error){}, Run: []string{}}
+}
+
+// checkTestCmdsRun checks that commands other than zfs list in tc are l
+func checkTestCmdsRun(t *testing.T, tc *testCmds, l []string) {
+	run := []string{}
+	for _, r := range tc.Run {
+		if !strings.HasPrefix(r, "zfs list ") {
+			run = append(run, r)
+		}
+	}
+	if strings.Join(run, "\n") != strings.Join(l, "\n") {
+		t.Errorf("Commands run:\n%s\nwant:\n%s", strings.Join(run, "\n"), strings.Join(l, "\n"))
+	}
+}
+
+// newTestJailguard returns Jailguard with data in a temporary directory and
+// an empty state
+func newTestJailguard(t *testing.T, mirrors string) (*Jailguard, func()) {
+	d, err := ioutil.TempDir("", "jailguard-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := &Jailguard{Quiet: true}
+	j.initLogger()
+	j.cli = NewJailguardCLI(j)
+	cfg, err := NewConfig(d + "/jailguard.conf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	cfg.PathData = d + "/data"
+	cfg.Mirrors = mirrors
+	cfg.ZFS = "off"
+	j.config = cfg
+
+	err = os.MkdirAll(cfg.GetDirPath(cfg.DirState), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(j.getStateFilePath(), []byte(fmt.Sprintf(`{"version":"%d","bases":{},"jails":{},"network_interfaces":{},"jail_port_fwds":{},"jail_nat_passes":{}}`, STATE_VERSION)), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return j, func() {
+		j.releaseState()
+		os.RemoveAll(d)
+	}
+}
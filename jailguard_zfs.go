@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+)
+
+func (j *Jailguard) getZFS() *ZFS {
+	z := NewZFS()
+	z.SetLogger(func(t int, s string) {
+		j.Log(t, s)
+	})
+	return z
+}
+
+// getChildDataset returns dataset for directory n within directory d. It is
+// empty when d is not on ZFS or n already exists as a plain directory.
+func (j *Jailguard) getChildDataset(d string, n string) (string, error) {
+	if j.GetConfig().ZFS == "off" {
+		return "", nil
+	}
+	z := j.getZFS()
+	ds, err := z.GetDirDataset(d)
+	if err != nil || ds == "" {
+		return "", err
+	}
+	ds = ds + "/" + n
+	if z.Exists(ds) {
+		return ds, nil
+	}
+	_, _, err = StatWithLog(d+"/"+n, j.Log)
+	if err == nil {
+		return "", nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	return ds, nil
+}
+
+func (j *Jailguard) getBaseDataset(rls string) (string, error) {
+	c := j.GetConfig()
+	return j.getChildDataset(c.GetDirPath(c.DirBases), rls)
+}
+
+func (j *Jailguard) getJailDataset(n string) (string, error) {
+	c := j.GetConfig()
+	return j.getChildDataset(c.GetDirPath(c.DirJails), n)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const JAILSNAPSHOT_TYPE_ZFS = "zfs"
+const JAILSNAPSHOT_TYPE_TAR = "tar"
+
+// JailSnapshot is a point-in-time copy of jail directory. It is a ZFS
+// snapshot when jail directory is a dataset, otherwise a tarball.
+type JailSnapshot struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	Created  string `json:"created"`
+	Type     string `json:"type"`
+	Snapshot string `json:"snapshot"`
+	Filepath string `json:"filepath"`
+}
+
+// GetJailSnapshotID returns snapshot ID made of the current time and optional
+// label that is not in the list yet, eg. 20200101-120000.before-upgrade
+func GetJailSnapshotID(l []*JailSnapshot, lbl string) string {
+	id := time.Now().Format(STATESNAPSHOT_TIME_FORMAT)
+	for i := 1; ; i++ {
+		cid := id
+		if i > 1 {
+			cid = fmt.Sprintf("%s_%d", id, i)
+		}
+		if lbl != "" {
+			cid = cid + "." + lbl
+		}
+		found := false
+		for _, sn := range l {
+			if sn.ID == cid {
+				found = true
+			}
+		}
+		if !found {
+			return cid
+		}
+	}
+}
+
+func NewJailSnapshot(id string, lbl string) *JailSnapshot {
+	sn := &JailSnapshot{ID: id, Label: lbl}
+	sn.Created = GetCurrentDateTime()
+	return sn
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const JOURNAL_UNDO_REMOVE_PATH = "remove_path"
+const JOURNAL_UNDO_WRITE_FILE = "write_file"
+const JOURNAL_UNDO_STOP_JAIL = "stop_jail"
+const JOURNAL_UNDO_RELOAD_PF_RULES = "reload_pf_rules"
+const JOURNAL_UNDO_DESTROY_DATASET = "destroy_dataset"
+
+// JournalAction describes how to undo a step. It is written to the journal
+// file so it can only hold its type and string params.
+type JournalAction struct {
+	Type   string            `json:"type"`
+	Params map[string]string `json:"params"`
+}
+
+type JournalStep struct {
+	Name string           `json:"name"`
+	Done bool             `json:"done"`
+	Undo []*JournalAction `json:"undo"`
+}
+
+// Journal is a persisted list of steps of an operation that is in progress.
+// It is removed when the operation finishes or is rolled back so if it exists
+// on start then previous run has been interrupted.
+type Journal struct {
+	Operation string            `json:"operation"`
+	Params    map[string]string `json:"params"`
+	Started   string            `json:"started"`
+	User      string            `json:"user"`
+	Steps     []*JournalStep    `json:"steps"`
+
+	Filepath string `json:"-"`
+
+	logger func(int, string)
+}
+
+func (jr *Journal) SetLogger(f func(int, string)) {
+	jr.logger = f
+}
+
+func (jr *Journal) GetStep(n string) *JournalStep {
+	for _, s := range jr.Steps {
+		if s.Name == n {
+			return s
+		}
+	}
+	return nil
+}
+
+func (jr *Journal) IsDone(n string) bool {
+	s := jr.GetStep(n)
+	return s != nil && s.Done
+}
+
+func (jr *Journal) Save() error {
+	b, err := json.MarshalIndent(jr, "", "  ")
+	if err != nil {
+		return errors.New("Error has occurred while generating journal JSON: " + err.Error())
+	}
+	err = WriteFileAtomicWithLog(jr.Filepath, b, 0600, jr.logger)
+	if err != nil {
+		return errors.New("Error has occurred while writing journal: " + err.Error())
+	}
+	return nil
+}
+
+func (jr *Journal) Remove() error {
+	jr.logger(LOGDBG, fmt.Sprintf("Removing journal %s...", jr.Filepath))
+	err := os.Remove(jr.Filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("Error has occurred while removing journal: " + err.Error())
+	}
+	return nil
+}
+
+func (jr *Journal) Print(f *os.File) {
+	fmt.Fprintf(f, "Operation: %s\n", jr.Operation)
+	fmt.Fprintf(f, "Started: %s by %s\n", jr.Started, jr.User)
+
+	ks := []string{}
+	for k := range jr.Params {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	ps := []string{}
+	for _, k := range ks {
+		ps = append(ps, fmt.Sprintf("%s=%s", k, jr.Params[k]))
+	}
+	fmt.Fprintf(f, "Params: %s\n", strings.Join(ps, " "))
+
+	fmt.Fprintf(f, "Steps:\n")
+	for i, s := range jr.Steps {
+		st := "done"
+		if !s.Done {
+			st = "not finished"
+		}
+		fmt.Fprintf(f, "  %d. %s (%s)\n", i+1, s.Name, st)
+	}
+}
+
+func NewJournalAction(t string, p map[string]string) *JournalAction {
+	return &JournalAction{Type: t, Params: p}
+}
+
+func NewJournal(p string, op string, params map[string]string) *Journal {
+	jr := &Journal{
+		Operation: op,
+		Params:    params,
+		Started:   GetCurrentDateTime(),
+		User:      GetInvokingUser(),
+		Steps:     []*JournalStep{},
+		Filepath:  p,
+	}
+	return jr
+}
+
+// LoadJournal reads journal from a file. When the file does not exist then
+// nil is returned.
+func LoadJournal(p string) (*Journal, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.New("Error has occurred while reading journal: " + err.Error())
+	}
+	jr := &Journal{}
+	err = json.Unmarshal(b, jr)
+	if err != nil {
+		return nil, errors.New("Error has occurred while parsing journal: " + err.Error())
+	}
+	jr.Filepath = p
+	return jr, nil
+}
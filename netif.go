@@ -31,8 +31,8 @@ func (ni *Netif) SetDefaultValues() {
 	ni.Iteration = 1
 }
 
-func (ni *Netif) AddHistoryEntry(s string) {
-	he := NewHistoryEntry(GetCurrentDateTime(), s)
+func (ni *Netif) AddHistoryEntry(op string, p map[string]string, err error) {
+	he := NewHistoryEntry(op, "netif", ni.Name, p, err)
 	if ni.History == nil {
 		ni.History = []*HistoryEntry{}
 	}
@@ -125,6 +125,25 @@ func (ni *Netif) isAliasExists(ip string) (bool, error) {
 	return false, nil
 }
 
+func (ni *Netif) GetOSAliases() ([]string, bool, error) {
+	ni.logger(LOGDBG, fmt.Sprintf("Getting aliases of network interface %s from the system...", ni.SystemName))
+	if ni.SystemName == "" {
+		return nil, false, nil
+	}
+	out, err := CmdOut(ni.logger, "ifconfig", ni.SystemName)
+	if err != nil {
+		ni.logger(LOGDBG, fmt.Sprintf("Network interface %s does not exist in the system", ni.SystemName))
+		return nil, false, nil
+	}
+
+	as := []string{}
+	re := regexp.MustCompile(`inet ([0-9\.]+) netmask`)
+	for _, m := range re.FindAllStringSubmatch(string(out), -1) {
+		as = append(as, m[1])
+	}
+	return as, true, nil
+}
+
 func (ni *Netif) ifconfigAliasAdd(ip string) error {
 	ni.logger(LOGDBG, fmt.Sprintf("Adding alias %s to network interface %s...", ip, ni.SystemName))
 	err := CmdRun(ni.logger, "ifconfig", ni.SystemName, "inet", ip+"/24", "alias")
@@ -191,10 +210,12 @@ func (ni *Netif) AddAlias(ip string) (string, error) {
 
 	err = ni.ifconfigAliasAdd(ip)
 	if err != nil {
+		ni.AddHistoryEntry("alias_add", map[string]string{"ip": ip}, err)
 		return "", errors.New("Error has occurred whilst adding alias")
 	}
 
 	ni.Aliases = append(ni.Aliases, ip)
+	ni.AddHistoryEntry("alias_add", map[string]string{"ip": ip}, nil)
 	return ip, nil
 }
 
@@ -207,6 +228,7 @@ func (ni *Netif) DeleteAlias(ip string) error {
 	if ex {
 		err = ni.ifconfigAliasDelete(ip)
 		if err != nil {
+			ni.AddHistoryEntry("alias_delete", map[string]string{"ip": ip}, err)
 			return errors.New("Error has occurred whilst deleting alias")
 		}
 	}
@@ -217,6 +239,8 @@ func (ni *Netif) DeleteAlias(ip string) error {
 			as = append(as, v)
 		}
 	}
+	ni.Aliases = as
+	ni.AddHistoryEntry("alias_delete", map[string]string{"ip": ip}, nil)
 	return nil
 }
 
@@ -232,12 +256,12 @@ func (ni *Netif) Create() error {
 			return err
 		}
 		if ex {
-			return errors.New(fmt.Sprintf("Network interface already exists in the system", ni.SystemName))
+			return errors.New(fmt.Sprintf("Network interface %s already exists in the system", ni.SystemName))
 		}
 
 		v := ni.isSystemNameValid()
 		if !v {
-			return errors.New(fmt.Sprintf("Network interface should be 'lo' suffixed with number", ni.SystemName))
+			return errors.New(fmt.Sprintf("Network interface %s should be 'lo' suffixed with number", ni.SystemName))
 		}
 	} else {
 		nu, err := ni.getFreeSystemName()
@@ -247,19 +271,91 @@ func (ni *Netif) Create() error {
 		ni.SystemName = nu
 	}
 
+	p := map[string]string{"system_name": ni.SystemName, "ip_addr_begin": ni.IPAddrBegin, "ip_addr_end": ni.IPAddrEnd}
 	err := ni.ifconfigCreate()
 	if err != nil {
+		ni.AddHistoryEntry("create", p, err)
 		return errors.New("Error creating network interface")
 	}
 
 	err = ni.ifconfigUp()
 	if err != nil {
+		ni.AddHistoryEntry("create", p, err)
 		return errors.New("Error bringing network interface up")
 	}
 
+	ni.AddHistoryEntry("create", p, nil)
 	return nil
 }
 
+func (ni *Netif) Recreate() error {
+	if ni.SystemName == "" {
+		return errors.New("Network interface does not have a system name")
+	}
+
+	p := map[string]string{"system_name": ni.SystemName}
+	err := ni.ifconfigCreate()
+	if err != nil {
+		ni.AddHistoryEntry("recreate", p, err)
+		return errors.New("Error creating network interface")
+	}
+
+	err = ni.ifconfigUp()
+	if err != nil {
+		ni.AddHistoryEntry("recreate", p, err)
+		return errors.New("Error bringing network interface up")
+	}
+
+	for _, ip := range ni.Aliases {
+		err = ni.ifconfigAliasAdd(ip)
+		if err != nil {
+			ni.AddHistoryEntry("recreate", p, err)
+			return errors.New(fmt.Sprintf("Error has occurred whilst adding alias %s", ip))
+		}
+	}
+	ni.AddHistoryEntry("recreate", p, nil)
+	return nil
+}
+
+func (ni *Netif) RecreateAlias(ip string) error {
+	err := ni.ifconfigAliasAdd(ip)
+	ni.AddHistoryEntry("alias_recreate", map[string]string{"ip": ip}, err)
+	if err != nil {
+		return errors.New("Error has occurred whilst adding alias")
+	}
+	return nil
+}
+
+func (ni *Netif) RemoveOSAlias(ip string) error {
+	err := ni.ifconfigAliasDelete(ip)
+	ni.AddHistoryEntry("alias_remove_from_os", map[string]string{"ip": ip}, err)
+	if err != nil {
+		return errors.New("Error has occurred whilst deleting alias")
+	}
+	return nil
+}
+
+func (ni *Netif) AddAliasToState(ip string) {
+	for _, v := range ni.Aliases {
+		if v == ip {
+			return
+		}
+	}
+	ni.Aliases = append(ni.Aliases, ip)
+	ni.AddHistoryEntry("alias_add_to_state", map[string]string{"ip": ip}, nil)
+}
+
+func (ni *Netif) RemoveAliasFromState(ip string) {
+	as := []string{}
+	for _, v := range ni.Aliases {
+		if v != ip {
+			as = append(as, v)
+		}
+	}
+	ni.Aliases = as
+	ni.AddHistoryEntry("alias_remove_from_state", map[string]string{"ip": ip}, nil)
+}
+
 func (ni *Netif) Destroy() error {
 	if ni.SystemName != "" {
 		ex, err := ni.isSystemNameExists()
@@ -271,6 +367,7 @@ func (ni *Netif) Destroy() error {
 		}
 
 		err = ni.ifconfigDestroy()
+		ni.AddHistoryEntry("destroy", map[string]string{"system_name": ni.SystemName}, err)
 		if err != nil {
 			return errors.New("Error destroying network interface")
 		}
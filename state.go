@@ -9,6 +9,9 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type State struct {
@@ -28,6 +31,15 @@ type State struct {
 
 	Filepath string `json:"filepath"`
 
+	migratedFrom int
+	backupPath   string
+	beforeSave   func() error
+	saved        bool
+
+	historyMaxEntries int
+	historyMaxAge     time.Duration
+	historyArchive    func([]*HistoryEntry) error
+
 	logger func(int, string)
 }
 
@@ -36,16 +48,57 @@ func (st *State) SetLogger(f func(int, string)) {
 }
 
 func (st *State) SetDefaultValues() {
-	st.Version = "2"
+	st.Version = strconv.Itoa(STATE_VERSION)
 	st.Software = "jailguard " + VERSION
 	st.Iteration++
 }
 
-func (st *State) AddHistoryEntry(s string) {
-	he := NewHistoryEntry(GetCurrentDateTime(), s)
+// SetBeforeSave sets a function that is called once, before the state is
+// written to the file for the first time
+func (st *State) SetBeforeSave(f func() error) {
+	st.beforeSave = f
+}
+
+// SetHistoryRetention sets how many history entries each history list keeps
+// and how old they can get. Entries over the limits are passed to fn when the
+// state is saved. Zero means no limit.
+func (st *State) SetHistoryRetention(max int, age time.Duration, fn func([]*HistoryEntry) error) {
+	st.historyMaxEntries = max
+	st.historyMaxAge = age
+	st.historyArchive = fn
+}
+
+func (st *State) GetMigratedFrom() (int, string) {
+	return st.migratedFrom, st.backupPath
+}
+
+func (st *State) AddHistoryEntry(op string, t string, n string, p map[string]string, err error) {
+	he := NewHistoryEntry(op, t, n, p, err)
 	st.History = append(st.History, he)
 }
 
+// GetHistoryEntries returns history of the state and all of its items
+func (st *State) GetHistoryEntries() []*HistoryEntry {
+	hs := []*HistoryEntry{}
+	hs = append(hs, st.History...)
+	for _, bs := range st.Bases {
+		hs = append(hs, bs.History...)
+	}
+	for _, jl := range st.Jails {
+		hs = append(hs, jl.History...)
+		if jl.Config != nil {
+			hs = append(hs, jl.Config.History...)
+		}
+		if jl.Dir != nil {
+			hs = append(hs, jl.Dir.History...)
+		}
+	}
+	for _, ni := range st.Netifs {
+		hs = append(hs, ni.History...)
+	}
+	return hs
+}
+
 func (st *State) GetBase(rls string) (*Base, error) {
 	st.logger(LOGDBG, fmt.Sprintf("Getting base %s from the state...", rls))
 	if st.Bases[rls] == nil {
@@ -114,7 +167,7 @@ func (st *State) GetJailPortFwdsFilterJail(dst_jail string) map[string]*JailPort
 	st.logger(LOGDBG, fmt.Sprintf("Getting jail port fwds with dst jail of %s...", dst_jail))
 	m := make(map[string]*JailPortFwd)
 	for k, v := range st.JailPortFwds {
-		if v.DstJail == dst_jail {
+		if v != nil && v.DstJail == dst_jail {
 			st.logger(LOGDBG, fmt.Sprintf("Found jail port fwd %s", k))
 			m[k] = v
 		}
@@ -125,34 +178,35 @@ func (st *State) GetJailPortFwdsFilterJail(dst_jail string) map[string]*JailPort
 func (st *State) AddBase(rls string, bs *Base) {
 	st.logger(LOGDBG, fmt.Sprintf("Adding base %s to the state...", rls))
 	st.Bases[rls] = bs
-	st.AddHistoryEntry(fmt.Sprintf("Add base %s", rls))
+	st.AddHistoryEntry("add", "base", rls, nil, nil)
 }
 
 func (st *State) AddJail(n string, jl *Jail) {
 	st.logger(LOGDBG, fmt.Sprintf("Adding jail %s to the state...", n))
 	st.Jails[n] = jl
-	st.AddHistoryEntry(fmt.Sprintf("Add jail %s", n))
+	st.AddHistoryEntry("add", "jail", n, nil, nil)
 }
 
 func (st *State) AddNetif(n string, ni *Netif) {
 	st.logger(LOGDBG, fmt.Sprintf("Adding netif %s to the state...", n))
 	st.Netifs[n] = ni
-	st.AddHistoryEntry(fmt.Sprintf("Add netif %s", n))
+	st.AddHistoryEntry("add", "netif", n, map[string]string{"system_name": ni.SystemName}, nil)
 }
 
 func (st *State) AddJailPortFwd(n string, fwd *JailPortFwd) {
 	st.logger(LOGDBG, fmt.Sprintf("Adding jail port fwd from interface %s port %s to jail %s port %s to the state...", fwd.SrcIf, fwd.SrcPort, fwd.DstJail, fwd.DstPort))
 	st.JailPortFwds[n] = fwd
-	st.AddHistoryEntry(fmt.Sprintf("Add jailportfwd %s", n))
+	st.AddHistoryEntry("add", "jailportfwd", n, map[string]string{"src_if": fwd.SrcIf, "src_port": fwd.SrcPort, "dst_jail": fwd.DstJail, "dst_port": fwd.DstPort}, nil)
 }
 
 func (st *State) AddJailNATPass(n string, np *JailNATPass) {
 	st.logger(LOGDBG, fmt.Sprintf("Adding nat pass for jail %s to the state...", n))
 	st.JailNATPasses[n] = np
-	st.AddHistoryEntry(fmt.Sprintf("Add nat pass for jail %s", n))
+	st.AddHistoryEntry("add", "jailnatpass", n, map[string]string{"gw_if": np.GwIf}, nil)
 }
 
-func (st *State) RemoveItem(t string, n string) error {
+// DeleteItem removes item from the state without saving it
+func (st *State) DeleteItem(t string, n string) error {
 	if n == "" {
 		return errors.New("Invalid name")
 	}
@@ -172,22 +226,40 @@ func (st *State) RemoveItem(t string, n string) error {
 		return errors.New("Invalid state item type")
 	}
 
-	err := st.Save()
+	st.AddHistoryEntry("remove", t, n, nil, nil)
+	return nil
+}
+
+func (st *State) RemoveItem(t string, n string) error {
+	err := st.DeleteItem(t, n)
+	if err != nil {
+		return err
+	}
+
+	err = st.Save()
 	if err != nil {
 		return errors.New("Cannot save state to a file")
 	}
 	st.logger(LOGDBG, fmt.Sprintf("Item %s %s has been removed from the state", t, n))
 
-	st.AddHistoryEntry(fmt.Sprintf("Remove item %s %s", t, n))
-
 	return nil
 }
 
 func (st *State) PrintItems(f *os.File, t string) error {
 	st.logger(LOGDBG, "Printing out state items...")
 	if t == "" || t == "bases" {
+		sd := NewStateDeps(st)
 		for k, _ := range st.Bases {
-			fmt.Fprintf(f, "base %s\n", k)
+			jls := []string{}
+			for _, d := range sd.GetDependants("base", k) {
+				if d.Type == "jail" {
+					jls = append(jls, d.Name)
+				}
+			}
+			if len(jls) == 0 {
+				jls = append(jls, "-")
+			}
+			fmt.Fprintf(f, "base %s jails %s\n", k, strings.Join(jls, ","))
 		}
 	}
 	if t == "" || t == "jails" {
@@ -317,6 +389,86 @@ func (st *State) removeNilItems() {
 	st.removeNilItemsJailNATPass()
 }
 
+func (st *State) getHistoryLists() []*[]*HistoryEntry {
+	l := []*[]*HistoryEntry{&st.History}
+	for _, bs := range st.Bases {
+		l = append(l, &bs.History)
+	}
+	for _, jl := range st.Jails {
+		l = append(l, &jl.History)
+		if jl.Config != nil {
+			l = append(l, &jl.Config.History)
+		}
+		if jl.Dir != nil {
+			l = append(l, &jl.Dir.History)
+		}
+	}
+	for _, ni := range st.Netifs {
+		l = append(l, &ni.History)
+	}
+	return l
+}
+
+func trimHistory(hs []*HistoryEntry, max int, cutoff time.Time) ([]*HistoryEntry, []*HistoryEntry) {
+	kept := []*HistoryEntry{}
+	removed := []*HistoryEntry{}
+	for _, he := range hs {
+		if he == nil {
+			continue
+		}
+		if !cutoff.IsZero() {
+			t, err := he.GetTime()
+			if err == nil && t.Before(cutoff) {
+				removed = append(removed, he)
+				continue
+			}
+		}
+		kept = append(kept, he)
+	}
+	if max > 0 && len(kept) > max {
+		removed = append(removed, kept[:len(kept)-max]...)
+		kept = kept[len(kept)-max:]
+	}
+	return kept, removed
+}
+
+// compactHistory removes entries over the retention limits from history
+// lists. Removed entries are returned with a function that puts them back.
+func (st *State) compactHistory() ([]*HistoryEntry, func()) {
+	if st.historyMaxEntries == 0 && st.historyMaxAge == 0 {
+		return nil, func() {}
+	}
+
+	var cutoff time.Time
+	if st.historyMaxAge > 0 {
+		cutoff = time.Now().Add(-st.historyMaxAge)
+	}
+
+	ls := st.getHistoryLists()
+	kept := make([][]*HistoryEntry, len(ls))
+	removed := []*HistoryEntry{}
+	for i, l := range ls {
+		var r []*HistoryEntry
+		kept[i], r = trimHistory(*l, st.historyMaxEntries, cutoff)
+		removed = append(removed, r...)
+	}
+	if len(removed) == 0 {
+		return nil, func() {}
+	}
+
+	st.logger(LOGDBG, fmt.Sprintf("Moving %d history entries out of the state...", len(removed)))
+	orig := make([][]*HistoryEntry, len(ls))
+	for i, l := range ls {
+		orig[i] = *l
+		*l = kept[i]
+	}
+	return removed, func() {
+		for i, l := range ls {
+			*l = orig[i]
+		}
+	}
+}
+
 func (st *State) Save() error {
 	st.logger(LOGDBG, "Preparing the state to be saved into the file...")
 	st.SetDefaultValues()
@@ -328,6 +480,32 @@ func (st *State) Save() error {
 	st.removeNilFields()
 	st.removeNilItems()
 
+	// Entries are archived only when the state without them has been
+	// written, otherwise they would be archived again on the next save
+	removed, restore := st.compactHistory()
+	err := st.write()
+	if err != nil {
+		restore()
+		return err
+	}
+
+	if len(removed) > 0 && st.historyArchive != nil {
+		err = st.historyArchive(removed)
+		if err != nil {
+			restore()
+			err2 := st.write()
+			if err2 != nil {
+				return errors.New(fmt.Sprintf("Error has occurred while archiving history entries and they could not be put back into the state: %s", err2.Error()))
+			}
+			return err
+		}
+	}
+
+	st.logger(LOGDBG, fmt.Sprintf("State has been successfully saved to %s", st.Filepath))
+	return nil
+}
+
+func (st *State) write() error {
 	st.logger(LOGDBG, "Generating state JSON...")
 	o, err := json.Marshal(st)
 	if err != nil {
@@ -351,16 +529,18 @@ func (st *State) Save() error {
 		return errors.New("Path for state directory is not a directory")
 	}
 
+	if st.beforeSave != nil && !st.saved {
+		err = st.beforeSave()
+		if err != nil {
+			return err
+		}
+	}
+	st.saved = true
+
 	st.Iteration++
 
 	st.logger(LOGDBG, fmt.Sprintf("Writing the state to %s...", st.Filepath))
-	err = ioutil.WriteFile(st.Filepath, o, 0644)
-	if err != nil {
-		return err
-	}
-
-	st.logger(LOGDBG, fmt.Sprintf("State has been successfully saved to %s", st.Filepath))
-	return nil
+	return WriteFileAtomicWithLog(st.Filepath, o, 0644, st.logger)
 }
 
 func NewState(f string) (*State, error) {
@@ -381,6 +561,26 @@ func NewState(f string) (*State, error) {
 	if err != nil {
 		return nil, errors.New("Error has occurred while reading state file: " + err.Error())
 	}
+
+	v, err := getStateFileVersion(b)
+	if err != nil {
+		return nil, errors.New("Error has occurred while parsing state file: " + err.Error())
+	}
+	if v > STATE_VERSION {
+		return nil, errors.New(fmt.Sprintf("State file has been written by a newer jailguard (state version %d, supported %d). Please upgrade jailguard", v, STATE_VERSION))
+	}
+	if v < STATE_VERSION {
+		st.backupPath, err = BackupVersionedFile(f, v)
+		if err != nil {
+			return nil, errors.New("Error has occurred while making a backup of state file: " + err.Error())
+		}
+		b, err = migrateState(b, v)
+		if err != nil {
+			return nil, err
+		}
+		st.migratedFrom = v
+	}
+
 	err = json.Unmarshal(b, st)
 	if err != nil {
 		return nil, errors.New("Error has occurred while parsing state file: " + err.Error())
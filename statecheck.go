@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const STATECHECK_OK = "ok"
+const STATECHECK_MISSING_IN_OS = "missing-in-os"
+const STATECHECK_MISSING_IN_STATE = "missing-in-state"
+const STATECHECK_MISMATCH = "mismatch"
+
+type StateCheckItem struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Parent  string `json:"parent"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+type StateCheck struct {
+	Items []*StateCheckItem `json:"items"`
+
+	logger func(int, string)
+}
+
+func (sc *StateCheck) SetLogger(f func(int, string)) {
+	sc.logger = f
+}
+
+func (sc *StateCheck) Add(t string, n string, p string, s string, d string) {
+	sc.logger(LOGDBG, fmt.Sprintf("State check of %s %s: %s", t, n, s))
+	sc.Items = append(sc.Items, &StateCheckItem{Type: t, Name: n, Parent: p, Status: s, Details: d})
+}
+
+func (sc *StateCheck) GetDrift() []*StateCheckItem {
+	d := []*StateCheckItem{}
+	for _, it := range sc.Items {
+		if it.Status != STATECHECK_OK {
+			d = append(d, it)
+		}
+	}
+	return d
+}
+
+func (sc *StateCheck) HasDrift() bool {
+	return len(sc.GetDrift()) > 0
+}
+
+func (sc *StateCheck) Print(f *os.File) {
+	for _, it := range sc.Items {
+		n := it.Name
+		if it.Parent != "" {
+			n = it.Parent + " " + it.Name
+		}
+		if it.Details != "" {
+			fmt.Fprintf(f, "%s %s %s (%s)\n", it.Type, n, it.Status, it.Details)
+		} else {
+			fmt.Fprintf(f, "%s %s %s\n", it.Type, n, it.Status)
+		}
+	}
+}
+
+func NewStateCheck() *StateCheck {
+	sc := &StateCheck{}
+	sc.Items = []*StateCheckItem{}
+	return sc
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StateItemRef points to an item in the state. Netif aliases are referred to
+// with type netif_alias and name of NETIF/IP.
+type StateItemRef struct {
+	Type string
+	Name string
+}
+
+func (r StateItemRef) String() string {
+	return fmt.Sprintf("%s %s", r.Type, r.Name)
+}
+
+// StateDeps is a graph of dependencies between state items
+type StateDeps struct {
+	dependants map[StateItemRef][]StateItemRef
+}
+
+func (sd *StateDeps) add(from StateItemRef, to StateItemRef) {
+	sd.dependants[to] = append(sd.dependants[to], from)
+}
+
+// GetDependants returns items that depend on item of type t and name n
+func (sd *StateDeps) GetDependants(t string, n string) []StateItemRef {
+	l := append([]StateItemRef{}, sd.dependants[StateItemRef{Type: t, Name: n}]...)
+	sort.Slice(l, func(i, k int) bool {
+		return l[i].String() < l[k].String()
+	})
+	return l
+}
+
+func GetNetifAliasRefName(n string, ip string) string {
+	return n + "/" + ip
+}
+
+// GetJailIPv4Addrs returns IP addresses from jail's ip4.addr which may be a
+// comma separated list with interface and netmask, eg. "lo1|10.0.0.2/32"
+func GetJailIPv4Addrs(jl *Jail) []string {
+	l := []string{}
+	if jl.Config == nil || jl.Config.Config["ip4.addr"] == "" {
+		return l
+	}
+	for _, a := range strings.Split(jl.Config.Config["ip4.addr"], ",") {
+		a = strings.TrimSpace(a)
+		if i := strings.Index(a, "|"); i > -1 {
+			a = a[i+1:]
+		}
+		if i := strings.Index(a, "/"); i > -1 {
+			a = a[:i]
+		}
+		if a != "" {
+			l = append(l, a)
+		}
+	}
+	return l
+}
+
+func NewStateDeps(st *State) *StateDeps {
+	sd := &StateDeps{dependants: map[StateItemRef][]StateItemRef{}}
+
+	for n, jl := range st.Jails {
+		if jl == nil {
+			continue
+		}
+		r := StateItemRef{Type: "jail", Name: n}
+		if jl.Release != "" && st.Bases[jl.Release] != nil {
+			sd.add(r, StateItemRef{Type: "base", Name: jl.Release})
+		}
+
+		ips := GetJailIPv4Addrs(jl)
+		for nn, ni := range st.Netifs {
+			if ni == nil {
+				continue
+			}
+			uses := jl.Config != nil && ni.SystemName != "" && jl.Config.Config["interface"] == ni.SystemName
+			for _, ip := range ips {
+				for _, a := range ni.Aliases {
+					if a == ip {
+						uses = true
+						sd.add(r, StateItemRef{Type: "netif_alias", Name: GetNetifAliasRefName(nn, ip)})
+					}
+				}
+			}
+			if uses {
+				sd.add(r, StateItemRef{Type: "netif", Name: nn})
+			}
+		}
+	}
+
+	for n, fwd := range st.JailPortFwds {
+		if fwd != nil {
+			sd.add(StateItemRef{Type: "jailportfwd", Name: n}, StateItemRef{Type: "jail", Name: fwd.DstJail})
+		}
+	}
+	for n, nat := range st.JailNATPasses {
+		if nat != nil {
+			sd.add(StateItemRef{Type: "jailnatpass", Name: n}, StateItemRef{Type: "jail", Name: n})
+		}
+	}
+
+	return sd
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const STATEFIX_TOWARDS_OS = "os"
+const STATEFIX_TOWARDS_STATE = "state"
+
+type StateFix struct {
+	*ActionPlan
+	Towards string
+	Skipped []string
+}
+
+func (sf *StateFix) Skip(d string) {
+	sf.Skipped = append(sf.Skipped, d)
+}
+
+func (sf *StateFix) Print(f *os.File) {
+	if sf.Towards == STATEFIX_TOWARDS_OS {
+		sf.PrintActions(f, "Changes to be made in the system")
+	} else {
+		sf.PrintActions(f, "Changes to be made in the state")
+	}
+	if len(sf.Skipped) > 0 {
+		fmt.Fprintf(f, "Cannot be fixed automatically:\n")
+		for _, s := range sf.Skipped {
+			fmt.Fprintf(f, "  - %s\n", s)
+		}
+	}
+}
+
+func NewStateFix(towards string) *StateFix {
+	sf := &StateFix{ActionPlan: NewActionPlan(), Towards: towards}
+	sf.Skipped = []string{}
+	return sf
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const STATE_VERSION = 4
+
+// StateMigration upgrades raw state JSON from version From to From+1. It works
+// on a generic map so that fields removed or changed in newer versions can
+// still be read.
+type StateMigration struct {
+	From        int
+	Description string
+	fn          func(map[string]interface{}) error
+}
+
+var stateMigrations = []*StateMigration{
+	{From: 2, Description: "Convert free-text history entries to structured ones", fn: migrateStateV2History},
+	{From: 3, Description: "Fill in base release of jails from their history", fn: migrateStateV3JailRelease},
+}
+
+func getStateFileVersion(b []byte) (int, error) {
+	v := struct {
+		Version string `json:"version"`
+	}{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return 0, err
+	}
+	// Files written before versioning was checked always had version 2
+	if v.Version == "" {
+		return 2, nil
+	}
+	i, err := strconv.Atoi(v.Version)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid state version '%s'", v.Version))
+	}
+	return i, nil
+}
+
+func getStateMigration(v int) *StateMigration {
+	for _, m := range stateMigrations {
+		if m.From == v {
+			return m
+		}
+	}
+	return nil
+}
+
+func parseLegacyDateTime(s string) string {
+	// Legacy dates come from time.Time.String() which may contain monotonic
+	// clock reading, eg. "2020-05-01 10:00:00.123 +0000 UTC m=+0.001"
+	if i := strings.Index(s, " m="); i > -1 {
+		s = s[:i]
+	}
+	t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
+	if err != nil {
+		return s
+	}
+	return t.Format(time.RFC3339)
+}
+
+func migrateHistoryV2(v interface{}, t string, n string) []interface{} {
+	l := []interface{}{}
+	hs, ok := v.([]interface{})
+	if !ok {
+		return l
+	}
+	for _, h := range hs {
+		m, ok := h.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		e, _ := m["entry"].(string)
+		c, _ := m["created"].(string)
+		l = append(l, map[string]interface{}{
+			"time":      parseLegacyDateTime(c),
+			"operation": "legacy",
+			"item_type": t,
+			"item_name": n,
+			"result":    HISTORY_RESULT_OK,
+			"user":      "",
+			"entry":     e,
+		})
+	}
+	return l
+}
+
+func migrateItemsHistoryV2(v interface{}, t string, fn func(string, map[string]interface{})) {
+	items, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, i := range items {
+		m, ok := i.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		m["history"] = migrateHistoryV2(m["history"], t, k)
+		if fn != nil {
+			fn(k, m)
+		}
+	}
+}
+
+func migrateStateV2History(m map[string]interface{}) error {
+	m["history"] = migrateHistoryV2(m["history"], "state", "")
+	migrateItemsHistoryV2(m["bases"], "base", nil)
+	migrateItemsHistoryV2(m["network_interfaces"], "netif", nil)
+	migrateItemsHistoryV2(m["jails"], "jail", func(k string, jl map[string]interface{}) {
+		if c, ok := jl["config"].(map[string]interface{}); ok {
+			c["history"] = migrateHistoryV2(c["history"], "jailconf", k)
+		}
+		if d, ok := jl["dir"].(map[string]interface{}); ok {
+			d["history"] = migrateHistoryV2(d["history"], "jaildir", k)
+		}
+	})
+	return nil
+}
+
+// getHistoryCreateParam returns param k of the last successful create entry
+// in history v
+func getHistoryCreateParam(v interface{}, k string) string {
+	hs, _ := v.([]interface{})
+	p := ""
+	for _, h := range hs {
+		m, ok := h.(map[string]interface{})
+		if !ok || m["operation"] != "create" || m["result"] != HISTORY_RESULT_OK {
+			continue
+		}
+		ps, _ := m["params"].(map[string]interface{})
+		if s, _ := ps[k].(string); s != "" {
+			p = s
+		}
+	}
+	return p
+}
+
+// migrateStateV3JailRelease fills in release of jails created before it was
+// recorded. It comes either from the create entry of the jail or from path of
+// the base tarball its directory has been extracted from.
+func migrateStateV3JailRelease(m map[string]interface{}) error {
+	jls, _ := m["jails"].(map[string]interface{})
+	for _, v := range jls {
+		jl, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if rls, _ := jl["release"].(string); rls != "" {
+			continue
+		}
+		rls := getHistoryCreateParam(jl["history"], "release")
+		if rls == "" {
+			if d, ok := jl["dir"].(map[string]interface{}); ok {
+				t := strings.Split(getHistoryCreateParam(d["history"], "tarball"), ",")[0]
+				if strings.HasSuffix(t, "/"+BASE_SET_BASE+".txz") {
+					rls = filepath.Base(filepath.Dir(t))
+				}
+			}
+		}
+		if rls != "" {
+			jl["release"] = rls
+		}
+	}
+	return nil
+}
+
+func migrateState(b []byte, v int) ([]byte, error) {
+	m := make(map[string]interface{})
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	for ; v < STATE_VERSION; v++ {
+		sm := getStateMigration(v)
+		if sm == nil {
+			return nil, errors.New(fmt.Sprintf("No migration of state from version %d is available", v))
+		}
+		err = sm.fn(m)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error has occurred while migrating state from version %d: %s", v, err.Error()))
+		}
+		m["version"] = strconv.Itoa(v + 1)
+	}
+
+	return json.Marshal(m)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const STATESNAPSHOT_TIME_FORMAT = "20060102-150405"
+const STATESNAPSHOT_AUTO_LABEL = "auto"
+const STATESNAPSHOT_AUTO_KEEP = 20
+
+type StateSnapshot struct {
+	ID       string
+	Label    string
+	Created  time.Time
+	Size     int64
+	Filepath string
+}
+
+// StateSnapshots manages copies of the state file kept in a directory. Each
+// snapshot is named after the state file with a timestamp and an optional
+// label appended, eg. jailguard.jailstate.20200101-120000.auto
+type StateSnapshots struct {
+	Dirpath  string
+	FileName string
+
+	logger func(int, string)
+}
+
+func (ss *StateSnapshots) SetLogger(f func(int, string)) {
+	ss.logger = f
+}
+
+func (ss *StateSnapshots) List() ([]*StateSnapshot, error) {
+	l := []*StateSnapshot{}
+	fis, err := ioutil.ReadDir(ss.Dirpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, errors.New("Error has occurred while reading snapshots directory: " + err.Error())
+	}
+
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasPrefix(fi.Name(), ss.FileName+".") {
+			continue
+		}
+		id := strings.TrimPrefix(fi.Name(), ss.FileName+".")
+		a := strings.SplitN(id, ".", 2)
+		t, err := time.ParseInLocation(STATESNAPSHOT_TIME_FORMAT, strings.SplitN(a[0], "_", 2)[0], time.Local)
+		if err != nil {
+			continue
+		}
+		sn := &StateSnapshot{ID: id, Created: t, Size: fi.Size(), Filepath: filepath.Join(ss.Dirpath, fi.Name())}
+		if len(a) > 1 {
+			sn.Label = a[1]
+		}
+		l = append(l, sn)
+	}
+	sort.Slice(l, func(i, k int) bool {
+		return l[i].ID < l[k].ID
+	})
+	return l, nil
+}
+
+func (ss *StateSnapshots) Get(id string) (*StateSnapshot, error) {
+	l, err := ss.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, sn := range l {
+		if sn.ID == id {
+			return sn, nil
+		}
+	}
+	return nil, nil
+}
+
+func (ss *StateSnapshots) Take(f string, lbl string) (*StateSnapshot, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			ss.logger(LOGDBG, fmt.Sprintf("State file %s does not exist yet so there is nothing to snapshot", f))
+			return nil, nil
+		}
+		return nil, errors.New("Error has occurred while reading state file: " + err.Error())
+	}
+
+	_, _, err = StatWithLog(ss.Dirpath, ss.logger)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errors.New("Error has occurred while getting snapshots directory")
+		}
+		err = CreateDirWithLog(ss.Dirpath, ss.logger)
+		if err != nil {
+			return nil, errors.New("Error has occurred while creating snapshots directory")
+		}
+	}
+
+	now := time.Now()
+	id := now.Format(STATESNAPSHOT_TIME_FORMAT)
+	for i := 1; ; i++ {
+		cid := id
+		if i > 1 {
+			cid = fmt.Sprintf("%s_%d", id, i)
+		}
+		if lbl != "" {
+			cid = cid + "." + lbl
+		}
+		_, err = os.Stat(filepath.Join(ss.Dirpath, ss.FileName+"."+cid))
+		if os.IsNotExist(err) {
+			id = cid
+			break
+		}
+	}
+
+	sn := &StateSnapshot{ID: id, Label: lbl, Created: now, Size: int64(len(b)), Filepath: filepath.Join(ss.Dirpath, ss.FileName+"."+id)}
+	ss.logger(LOGDBG, fmt.Sprintf("Saving state snapshot %s...", sn.Filepath))
+	err = WriteFileAtomicWithLog(sn.Filepath, b, 0600, ss.logger)
+	if err != nil {
+		return nil, errors.New("Error has occurred while saving state snapshot: " + err.Error())
+	}
+	return sn, nil
+}
+
+func (ss *StateSnapshots) PruneLabel(lbl string, keep int) error {
+	l, err := ss.List()
+	if err != nil {
+		return err
+	}
+	m := []*StateSnapshot{}
+	for _, sn := range l {
+		if sn.Label == lbl {
+			m = append(m, sn)
+		}
+	}
+	for i := 0; i < len(m)-keep; i++ {
+		err = RemoveAllWithLog(m[i].Filepath, ss.logger)
+		if err != nil {
+			return errors.New("Error has occurred while removing old state snapshot")
+		}
+	}
+	return nil
+}
+
+func (ss *StateSnapshots) Print(f *os.File) error {
+	l, err := ss.List()
+	if err != nil {
+		return err
+	}
+	for _, sn := range l {
+		fmt.Fprintf(f, "%s %s %d\n", sn.ID, sn.Created.Format(time.RFC3339), sn.Size)
+	}
+	return nil
+}
+
+func NewStateSnapshots(dir string, fn string) *StateSnapshots {
+	ss := &StateSnapshots{Dirpath: dir, FileName: fn}
+	return ss
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const TEMPLATE_TARBALL_FILE = "root.tgz"
+const TEMPLATE_JAILFILE_FILE = "jail.json"
+const TEMPLATE_METADATA_FILE = "template.json"
+
+// Keys that differ between jails and are not kept in jail file skeleton
+var templateJailFileSkipKeys = []string{"name", "host.hostname", "path", "mount.fstab", "ip4.addr", "ip6.addr"}
+
+// Template is a jail captured into a directory with a tarball of its files,
+// a skeleton of its jail file and metadata describing where it comes from
+type Template struct {
+	Name       string   `json:"name"`
+	Created    string   `json:"created"`
+	SourceJail string   `json:"source_jail"`
+	Release    string   `json:"release"`
+	Sets       []string `json:"sets"`
+	BaseSHA256 string   `json:"base_sha256"`
+	SHA256     string   `json:"sha256"`
+	Dirpath    string   `json:"-"`
+
+	logger func(int, string)
+}
+
+// IsValidTemplateName checks name the same way template flags are checked so
+// that it cannot point outside the templates directory
+func IsValidTemplateName(n string) bool {
+	re := regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+	return re.MatchString(n)
+}
+
+func (t *Template) SetLogger(f func(int, string)) {
+	t.logger = f
+}
+
+func (t *Template) GetTarballPath() string {
+	return t.Dirpath + "/" + TEMPLATE_TARBALL_FILE
+}
+
+func (t *Template) GetJailFilePath() string {
+	return t.Dirpath + "/" + TEMPLATE_JAILFILE_FILE
+}
+
+func (t *Template) getMetadataPath() string {
+	return t.Dirpath + "/" + TEMPLATE_METADATA_FILE
+}
+
+// Load reads template metadata, false is returned when template does not
+// exist
+func (t *Template) Load() (bool, error) {
+	b, err := ioutil.ReadFile(t.getMetadataPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.New(fmt.Sprintf("Error has occurred when reading template %s: %s", t.Name, err.Error()))
+	}
+	err = json.Unmarshal(b, t)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Error has occurred when parsing template %s metadata: %s", t.Name, err.Error()))
+	}
+	return true, nil
+}
+
+// Create archives jail directory jd and writes skeleton of jail config jc
+func (t *Template) Create(jd *JailDir, jc *JailConf) error {
+	_, _, err := StatWithLog(t.Dirpath, t.logger)
+	if err == nil {
+		return errors.New(fmt.Sprintf("Template directory %s already exists", t.Dirpath))
+	}
+	if !os.IsNotExist(err) {
+		return errors.New("Error has occurred when creating template directory")
+	}
+
+	err = t.create(jd, jc)
+	if err != nil {
+		_ = RemoveAllWithLog(t.Dirpath, t.logger)
+		return err
+	}
+	t.logger(LOGDBG, fmt.Sprintf("Template %s has been successfully created in %s", t.Name, t.Dirpath))
+	return nil
+}
+
+func (t *Template) create(jd *JailDir, jc *JailConf) error {
+	err := CreateDirWithLog(t.Dirpath, t.logger)
+	if err != nil {
+		return err
+	}
+
+	// devfs may be mounted in the jail
+	err = CmdTarCreateWithLog(t.GetTarballPath(), jd.Dirpath, []string{"./dev/*"}, t.logger)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when archiving jail directory %s", jd.Dirpath))
+	}
+	t.SHA256, err = FileSHA256(t.GetTarballPath())
+	if err != nil {
+		return err
+	}
+
+	m := map[string]string{}
+	for k, v := range jc.Config {
+		if strings.HasPrefix(k, JAILCONF_JAILGUARD_PREFIX) {
+			continue
+		}
+		skip := false
+		for _, k2 := range templateJailFileSkipKeys {
+			if k == k2 {
+				skip = true
+			}
+		}
+		if !skip {
+			m[k] = v
+		}
+	}
+	b, err := json.MarshalIndent(&JailConfJSON{Version: "1", Jail: m}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = WriteFileAtomicWithLog(t.GetJailFilePath(), b, 0644, t.logger)
+	if err != nil {
+		return err
+	}
+
+	t.Created = GetCurrentDateTime()
+	b, err = json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomicWithLog(t.getMetadataPath(), b, 0644, t.logger)
+}
+
+func (t *Template) Verify() error {
+	sum, err := FileSHA256(t.GetTarballPath())
+	if err != nil {
+		return err
+	}
+	if sum != t.SHA256 {
+		return errors.New(fmt.Sprintf("Checksum of template %s tarball does not match", t.Name))
+	}
+	return nil
+}
+
+// ApplyJailFile sets values from jail file skeleton that are missing in jail
+// config jc
+func (t *Template) ApplyJailFile(jc *JailConf) error {
+	b, err := ioutil.ReadFile(t.GetJailFilePath())
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when reading template %s jail file: %s", t.Name, err.Error()))
+	}
+	v := &JailConfJSON{}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when parsing template %s jail file: %s", t.Name, err.Error()))
+	}
+	for k, val := range v.Jail {
+		if _, ok := jc.Config[k]; !ok {
+			jc.Config[k] = val
+		}
+	}
+	return nil
+}
+
+func (t *Template) Remove() error {
+	return RemoveAllWithLog(t.Dirpath, t.logger)
+}
+
+func NewTemplate(n string, dir string) *Template {
+	t := &Template{}
+	t.Name = n
+	t.Dirpath = dir
+	return t
+}
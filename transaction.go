@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Transaction runs steps of an operation and records them in a journal
+// together with the actions that undo them. Steps already done in the journal
+// are skipped so an interrupted operation can be resumed.
+type Transaction struct {
+	journal *Journal
+	undo    func(*JournalAction) error
+	resumed bool
+
+	logger func(int, string)
+}
+
+func (tx *Transaction) SetLogger(f func(int, string)) {
+	tx.logger = f
+}
+
+// SetResumed marks transaction as continuing an interrupted operation
+func (tx *Transaction) SetResumed(b bool) {
+	tx.resumed = b
+}
+
+func (tx *Transaction) IsResumed() bool {
+	return tx.resumed
+}
+
+func (tx *Transaction) IsDone(n string) bool {
+	return tx.journal.IsDone(n)
+}
+
+// Step runs fn unless it has already been done. The step is written to the
+// journal before fn is called so that even partially done step is undone on
+// rollback.
+func (tx *Transaction) Step(n string, fn func() error, undo ...*JournalAction) error {
+	if tx.journal.IsDone(n) {
+		tx.logger(LOGDBG, fmt.Sprintf("Step %s has already been done", n))
+		return nil
+	}
+
+	s := &JournalStep{Name: n, Undo: undo}
+	tx.journal.Steps = append(tx.journal.Steps, s)
+	err := tx.journal.Save()
+	if err != nil {
+		return err
+	}
+
+	tx.logger(LOGDBG, fmt.Sprintf("Running step %s...", n))
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	s.Done = true
+	return tx.journal.Save()
+}
+
+func (tx *Transaction) undoSteps(ss []*JournalStep) int {
+	failed := 0
+	for i := len(ss) - 1; i >= 0; i-- {
+		tx.logger(LOGDBG, fmt.Sprintf("Undoing step %s...", ss[i].Name))
+		for _, a := range ss[i].Undo {
+			err := tx.undo(a)
+			if err != nil {
+				tx.logger(LOGERR, fmt.Sprintf("Error has occurred while undoing step %s: %s", ss[i].Name, err.Error()))
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+// UndoUnfinished undoes steps that were started but not finished and removes
+// them from the journal.
+func (tx *Transaction) UndoUnfinished() error {
+	ss := []*JournalStep{}
+	done := []*JournalStep{}
+	for _, s := range tx.journal.Steps {
+		if s.Done {
+			done = append(done, s)
+		} else {
+			ss = append(ss, s)
+		}
+	}
+	if len(ss) == 0 {
+		return nil
+	}
+
+	failed := tx.undoSteps(ss)
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d undo actions have failed", failed))
+	}
+	tx.journal.Steps = done
+	return tx.journal.Save()
+}
+
+// Rollback undoes all the steps in reverse order. Journal is kept when any of
+// the undo actions fails so that rollback can be retried.
+func (tx *Transaction) Rollback() error {
+	failed := tx.undoSteps(tx.journal.Steps)
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d undo actions have failed. Fix the issue and run journal_rollback", failed))
+	}
+	return tx.journal.Remove()
+}
+
+func (tx *Transaction) Commit() error {
+	return tx.journal.Remove()
+}
+
+func NewTransaction(jr *Journal, undo func(*JournalAction) error) *Transaction {
+	tx := &Transaction{journal: jr, undo: undo}
+	return tx
+}
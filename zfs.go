@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ZFSDataset struct {
+	Name       string
+	Mountpoint string
+}
+
+// ZFS manages datasets with the zfs command
+type ZFS struct {
+	logger func(int, string)
+}
+
+func (z *ZFS) SetLogger(f func(int, string)) {
+	z.logger = f
+}
+
+func (z *ZFS) List() ([]*ZFSDataset, error) {
+	out, err := CmdOut(z.logger, "zfs", "list", "-H", "-o", "name,mountpoint", "-t", "filesystem")
+	if err != nil {
+		return nil, err
+	}
+	l := []*ZFSDataset{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fs := strings.Split(line, "\t")
+		if len(fs) != 2 {
+			continue
+		}
+		l = append(l, &ZFSDataset{Name: fs[0], Mountpoint: fs[1]})
+	}
+	return l, nil
+}
+
+// GetDirDataset returns dataset mounted at directory d. When d is not a
+// mountpoint, but its parent is, and d is missing or empty, then name of a
+// dataset that should be created for d is returned. Empty string means d is
+// not on ZFS and plain directories should be used.
+func (z *ZFS) GetDirDataset(d string) (string, error) {
+	l, err := z.List()
+	if err != nil {
+		z.logger(LOGDBG, fmt.Sprintf("Cannot list ZFS datasets, using plain directories: %s", err.Error()))
+		return "", nil
+	}
+	for _, ds := range l {
+		if ds.Mountpoint == d {
+			return ds.Name, nil
+		}
+	}
+
+	for _, ds := range l {
+		if ds.Mountpoint != filepath.Dir(d) {
+			continue
+		}
+		fis, err := ioutil.ReadDir(d)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if len(fis) > 0 {
+			z.logger(LOGDBG, fmt.Sprintf("Directory %s is not empty and not a dataset, using plain directories", d))
+			return "", nil
+		}
+		n := ds.Name + "/" + filepath.Base(d)
+		z.logger(LOGDBG, fmt.Sprintf("Directory %s is missing or empty so dataset %s will be created for it", d, n))
+		return n, nil
+	}
+
+	z.logger(LOGDBG, fmt.Sprintf("Directory %s is not on ZFS, using plain directories", d))
+	return "", nil
+}
+
+func (z *ZFS) Exists(n string) bool {
+	_, err := CmdOut(z.logger, "zfs", "list", "-H", "-t", "all", "-o", "name", n)
+	return err == nil
+}
+
+// Create creates dataset n together with its missing parents
+func (z *ZFS) Create(n string) error {
+	err := CmdRun(z.logger, "zfs", "create", "-p", n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when creating dataset %s: %s", n, err.Error()))
+	}
+	return nil
+}
+
+func (z *ZFS) Snapshot(n string) error {
+	err := CmdRun(z.logger, "zfs", "snapshot", n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when taking snapshot %s: %s", n, err.Error()))
+	}
+	return nil
+}
+
+// Clone creates dataset n from snapshot snap together with missing parents
+func (z *ZFS) Clone(snap string, n string) error {
+	err := CmdRun(z.logger, "zfs", "clone", "-p", snap, n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when cloning %s to %s: %s", snap, n, err.Error()))
+	}
+	return nil
+}
+
+// Rollback reverts dataset to snapshot n destroying snapshots taken after it
+func (z *ZFS) Rollback(n string) error {
+	err := CmdRun(z.logger, "zfs", "rollback", "-r", n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when rolling back to %s: %s", n, err.Error()))
+	}
+	return nil
+}
+
+// Destroy removes dataset or snapshot n together with its children and
+// snapshots
+func (z *ZFS) Destroy(n string) error {
+	err := CmdRun(z.logger, "zfs", "destroy", "-r", n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error has occurred when destroying %s: %s", n, err.Error()))
+	}
+	return nil
+}
+
+func NewZFS() *ZFS {
+	z := &ZFS{}
+	return z
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testZFS fakes zfs command with datasets kept in a map of their
+// mountpoints. Mountpoints of created datasets are created as directories.
+type testZFS struct {
+	Datasets  map[string]string
+	Snapshots map[string]bool
+}
+
+func (z *testZFS) create(n string, mp string) error {
+	z.Datasets[n] = mp
+	return os.MkdirAll(mp, 0755)
+}
+
+func (z *testZFS) run(a []string) ([]byte, error) {
+	switch a[0] {
+	case "list":
+		n := a[len(a)-1]
+		if n == "filesystem" {
+			l := []string{}
+			for ds, mp := range z.Datasets {
+				l = append(l, ds+"\t"+mp)
+			}
+			sort.Strings(l)
+			return []byte(strings.Join(l, "\n") + "\n"), nil
+		}
+		if z.Datasets[n] != "" || z.Snapshots[n] {
+			return []byte(n + "\n"), nil
+		}
+		return nil, errors.New("dataset does not exist")
+	case "create":
+		n := a[len(a)-1]
+		ps := []string{}
+		for p := n; z.Datasets[p] == ""; p = path.Dir(p) {
+			if p == "." || (a[1] != "-p" && p != n) {
+				return nil, errors.New("parent does not exist")
+			}
+			ps = append([]string{p}, ps...)
+		}
+		for _, p := range ps {
+			err := z.create(p, z.Datasets[path.Dir(p)]+"/"+path.Base(p))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []byte{}, nil
+	case "snapshot":
+		z.Snapshots[a[1]] = true
+		return []byte{}, nil
+	case "clone":
+		snap, n := a[len(a)-2], a[len(a)-1]
+		if !z.Snapshots[snap] {
+			return nil, errors.New("snapshot does not exist")
+		}
+		if z.Datasets[path.Dir(n)] == "" {
+			if a[1] != "-p" {
+				return nil, errors.New("parent does not exist")
+			}
+			_, err := z.run([]string{"create", "-p", path.Dir(n)})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []byte{}, z.create(n, z.Datasets[path.Dir(n)]+"/"+path.Base(n))
+	case "destroy":
+		n := a[len(a)-1]
+		for ds := range z.Datasets {
+			if ds == n || strings.HasPrefix(ds, n+"/") {
+				delete(z.Datasets, ds)
+			}
+		}
+		for s := range z.Snapshots {
+			if strings.HasPrefix(s, n+"@") || strings.HasPrefix(s, n+"/") {
+				delete(z.Snapshots, s)
+			}
+		}
+		return []byte{}, nil
+	}
+	return []byte{}, nil
+}
+
+// install makes tc run z for zfs commands
+func (z *testZFS) install(tc *testCmds) {
+	tc.Handlers["zfs"] = z.run
+}
+
+func newTestZFS(ds map[string]string) *testZFS {
+	return &testZFS{Datasets: ds, Snapshots: map[string]bool{}}
+}
+
+func TestZFSGetDirDataset(t *testing.T) {
+	d, err := ioutil.TempDir("", "jailguard-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	err = os.MkdirAll(d+"/full/file", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(d+"/empty", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := newTestCmds()
+	defer tc.install()()
+	newTestZFS(map[string]string{"tank": "/tank", "tank/jg": d, "tank/jg/bases": d + "/bases"}).install(tc)
+
+	z := NewZFS()
+	z.SetLogger(func(int, string) {})
+	for _, c := range []struct {
+		dir string
+		ds  string
+	}{
+		{d + "/bases", "tank/jg/bases"},
+		{d + "/jails", "tank/jg/jails"},
+		{d + "/empty", "tank/jg/empty"},
+		{d + "/full", ""},
+		{"/usr/jails", ""},
+	} {
+		ds, err := z.GetDirDataset(c.dir)
+		if err != nil {
+			t.Errorf("GetDirDataset(%s) returned error: %s", c.dir, err.Error())
+		}
+		if ds != c.ds {
+			t.Errorf("GetDirDataset(%s) returned '%s', want '%s'", c.dir, ds, c.ds)
+		}
+	}
+
+	for _, r := range tc.Run {
+		if !strings.HasPrefix(r, "zfs list ") {
+			t.Errorf("GetDirDataset has run '%s'", r)
+		}
+	}
+	_, err = os.Stat(d + "/jails")
+	if !os.IsNotExist(err) {
+		t.Errorf("GetDirDataset has created %s", d+"/jails")
+	}
+}
+
+func TestZFSGetDirDatasetWithoutZFS(t *testing.T) {
+	tc := newTestCmds()
+	defer tc.install()()
+	tc.Handlers["zfs"] = func([]string) ([]byte, error) {
+		return nil, errors.New("zfs: command not found")
+	}
+
+	z := NewZFS()
+	z.SetLogger(func(int, string) {})
+	ds, err := z.GetDirDataset("/usr/local/jailguard/jails")
+	if ds != "" || err != nil {
+		t.Errorf("GetDirDataset returned '%s' and %v, want no dataset and no error", ds, err)
+	}
+}